@@ -0,0 +1,37 @@
+package evaluate
+
+import (
+	"context"
+
+	"gosuda.org/deeplingua/internal/translate"
+)
+
+// BackTranslation is a translation translated back into the original language.
+type BackTranslation struct {
+	Text  string               `json:"text"`
+	Score float64              `json:"score"` // chrF of Text against the original, from 0 to 1
+	Usage translate.ModelUsage `json:"usage,omitempty"`
+}
+
+// EvaluateBackTranslation translates translated back into originalLanguage with t and
+// compares the result with original. It is a cheap, local alternative to the LLM judge.
+func EvaluateBackTranslation(
+	ctx context.Context,
+	original, translated string,
+	originalLanguage, translatedLanguage string,
+	t *translate.Translator,
+) (*BackTranslation, error) {
+	result, err := t.TranslateRequest(ctx, &translate.Request{
+		Text:           translated,
+		SourceLanguage: translatedLanguage,
+		TargetLanguage: originalLanguage,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &BackTranslation{
+		Text:  result.Text,
+		Score: ChrF(result.Text, original),
+		Usage: result.Usage,
+	}, nil
+}
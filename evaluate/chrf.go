@@ -0,0 +1,64 @@
+package evaluate
+
+import "unicode"
+
+const (
+	chrFOrder = 6 // longest character n-gram
+	chrFBeta  = 2 // recall is weighted twice as much as precision
+)
+
+// ChrF returns the chrF score of hypothesis against reference, from 0 to 1.
+// Whitespace is ignored and the precision and recall are averaged over the
+// character n-gram orders 1 to 6 that both texts are long enough for.
+func ChrF(hypothesis, reference string) float64 {
+	hyp := letters(hypothesis)
+	ref := letters(reference)
+	if len(hyp) == 0 && len(ref) == 0 {
+		return 1
+	}
+
+	var precision, recall float64
+	var orders int
+	for n := 1; n <= chrFOrder; n++ {
+		if len(hyp) < n || len(ref) < n {
+			break
+		}
+		refGrams := ngrams(ref, n)
+		var matches int
+		for gram, count := range ngrams(hyp, n) {
+			matches += min(count, refGrams[gram])
+		}
+		precision += float64(matches) / float64(len(hyp)-n+1)
+		recall += float64(matches) / float64(len(ref)-n+1)
+		orders++
+	}
+	if orders == 0 {
+		return 0
+	}
+	precision /= float64(orders)
+	recall /= float64(orders)
+	if precision+recall == 0 {
+		return 0
+	}
+
+	const b2 = chrFBeta * chrFBeta
+	return (1 + b2) * precision * recall / (b2*precision + recall)
+}
+
+func letters(s string) []rune {
+	rs := make([]rune, 0, len(s))
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			rs = append(rs, r)
+		}
+	}
+	return rs
+}
+
+func ngrams(rs []rune, n int) map[string]int {
+	grams := make(map[string]int, len(rs))
+	for i := 0; i+n <= len(rs); i++ {
+		grams[string(rs[i:i+n])]++
+	}
+	return grams
+}
@@ -0,0 +1,37 @@
+package evaluate_test
+
+import (
+	"math"
+	"testing"
+
+	"gosuda.org/deeplingua/evaluate"
+)
+
+func TestChrF(t *testing.T) {
+	tests := []struct {
+		name       string
+		hypothesis string
+		reference  string
+		want       float64
+	}{
+		{"identical", "The cat sat on the mat.", "The cat sat on the mat.", 1},
+		{"whitespace", "The cat  sat\non the mat.", "The cat sat on the mat.", 1},
+		{"disjoint", "xyz", "abc", 0},
+		{"empty", "", "", 1},
+		{"empty hypothesis", "", "abc", 0},
+		{"hangul", "고양이가 매트 위에 앉았다", "고양이가 매트 위에 앉았다", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := evaluate.ChrF(tt.hypothesis, tt.reference); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("ChrF(%q, %q) = %v, want %v", tt.hypothesis, tt.reference, got, tt.want)
+			}
+		})
+	}
+
+	near := evaluate.ChrF("The cat sat on a mat.", "The cat sat on the mat.")
+	far := evaluate.ChrF("A dog ran in the park.", "The cat sat on the mat.")
+	if !(0 < far && far < near && near < 1) {
+		t.Errorf("want 0 < %v < %v < 1", far, near)
+	}
+}
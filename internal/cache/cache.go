@@ -0,0 +1,153 @@
+// Package cache implements an append-only on-disk translation cache.
+package cache
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileName is the name of the log file inside the cache directory.
+const FileName = "translations.jsonl"
+
+var ErrClosed = errors.New("deeplingua: cache is closed")
+
+type record struct {
+	Key         string `json:"key"`
+	Translation string `json:"translation"`
+}
+
+type location struct {
+	offset int64
+	length int
+}
+
+// Store is a translation cache backed by an append-only log of JSON lines.
+// The log is indexed in memory when the store is opened; translations are read from disk on demand.
+// A Store is safe for concurrent use, but a directory must not be opened by two processes at once.
+type Store struct {
+	mu    sync.RWMutex
+	file  *os.File
+	size  int64
+	index map[string]location
+}
+
+// Open opens the cache in dir, creating the directory and the log if they do not exist.
+// A record cut off by a crash at the end of the log is discarded.
+func Open(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, FileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Store{file: f, index: make(map[string]location)}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) load() error {
+	r := bufio.NewReader(s.file)
+	var offset int64
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// Drop a partial last record so that the next one starts on a new line.
+			if len(line) > 0 {
+				if err := s.file.Truncate(offset); err != nil {
+					return err
+				}
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		var rec record
+		if json.Unmarshal(line, &rec) == nil && rec.Key != "" {
+			s.index[rec.Key] = location{offset: offset, length: len(line)}
+		}
+		offset += int64(len(line))
+	}
+	s.size = offset
+	return nil
+}
+
+// Get returns the translation stored under key.
+func (s *Store) Get(key string) (string, bool) {
+	s.mu.RLock()
+	loc, ok := s.index[key]
+	file := s.file
+	s.mu.RUnlock()
+	if !ok || file == nil {
+		return "", false
+	}
+
+	buf := make([]byte, loc.length)
+	if _, err := file.ReadAt(buf, loc.offset); err != nil {
+		return "", false
+	}
+	var rec record
+	if err := json.Unmarshal(buf, &rec); err != nil || rec.Key != key {
+		return "", false
+	}
+	return rec.Translation, true
+}
+
+// Put appends the translation of key to the log. A later Put of the same key replaces the earlier one.
+func (s *Store) Put(key string, translation string) error {
+	line, err := json.Marshal(record{Key: key, Translation: translation})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return ErrClosed
+	}
+	if existing, ok := s.index[key]; ok && existing.length == len(line) {
+		buf := make([]byte, existing.length)
+		if _, err := s.file.ReadAt(buf, existing.offset); err == nil && bytes.Equal(buf, line) {
+			return nil
+		}
+	}
+
+	if _, err := s.file.WriteAt(line, s.size); err != nil {
+		return err
+	}
+	s.index[key] = location{offset: s.size, length: len(line)}
+	s.size += int64(len(line))
+	return nil
+}
+
+// Len returns the number of cached translations.
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.index)
+}
+
+// Close syncs and closes the log.
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := errors.Join(s.file.Sync(), s.file.Close())
+	s.file = nil
+	return err
+}
@@ -0,0 +1,61 @@
+package cache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gosuda.org/deeplingua/internal/cache"
+)
+
+func TestStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := cache.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("a", "에이"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("b", "비\n줄바꿈"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("a", "에이2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate a crash in the middle of writing a record.
+	f, err := os.OpenFile(filepath.Join(dir, cache.FileName), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"key":"c","transl`)
+	f.Close()
+
+	s, err = cache.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", s.Len())
+	}
+	for key, want := range map[string]string{"a": "에이2", "b": "비\n줄바꿈"} {
+		if got, ok := s.Get(key); !ok || got != want {
+			t.Errorf("Get(%q) = %q, %v, want %q", key, got, ok, want)
+		}
+	}
+	if _, ok := s.Get("c"); ok {
+		t.Errorf("partial record was loaded")
+	}
+
+	if err := s.Put("c", "씨"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := s.Get("c"); !ok || got != "씨" {
+		t.Errorf("Get(c) = %q, %v after the partial record was discarded", got, ok)
+	}
+}
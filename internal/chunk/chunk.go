@@ -2,6 +2,7 @@ package chunk
 
 import (
 	"strings"
+	"unicode/utf8"
 
 	"cloud.google.com/go/vertexai/genai"
 	"cloud.google.com/go/vertexai/genai/tokenizer"
@@ -10,10 +11,36 @@ import (
 
 var tok, _ = tokenizer.New("gemini-1.5-flash")
 
+// DefaultMaxTokens is the token budget used by ChunkMarkdown.
+const DefaultMaxTokens = 4096
+
 // ChunkMarkdown splits the input text into smaller chunks, ensuring that each chunk does not exceed the token limit.
 // It handles code blocks and tries to split paragraphs at natural breakpoints (e.g., periods) to preserve the original formatting.
 // The resulting chunks are returned as a slice of strings.
 func ChunkMarkdown(input string) []string {
+	return ChunkMarkdownTokens(input, DefaultMaxTokens)
+}
+
+// ChunkMarkdownTokens is like ChunkMarkdown but uses maxTokens as the token budget of each chunk.
+// Think tags are chunks of their own, so that no chunk mixes reasoning with the text around it
+// or holds only one of the tags of a think block.
+func ChunkMarkdownTokens(input string, maxTokens int) []string {
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+
+	var chunks []string
+	for _, b := range SplitThink(input) {
+		if b.Kind == BlockTag {
+			chunks = append(chunks, b.Text)
+			continue
+		}
+		chunks = append(chunks, chunkMarkdown(b.Text, maxTokens)...)
+	}
+	return chunks
+}
+
+func chunkMarkdown(input string, maxTokens int) []string {
 	var chunks []string
 	var currentChunk strings.Builder
 	currentTokens := 0
@@ -34,7 +61,7 @@ func ChunkMarkdown(input string) []string {
 		}
 
 		// If adding this paragraph would exceed the token limit or it's a code block
-		if currentTokens+int(paragraphTokens.TotalTokens) > 4096 || inCodeBlock {
+		if currentTokens+int(paragraphTokens.TotalTokens) > maxTokens || inCodeBlock {
 			// If the current chunk is not empty, add it to chunks
 			if currentChunk.Len() > 0 {
 				chunks = append(chunks, currentChunk.String())
@@ -42,16 +69,16 @@ func ChunkMarkdown(input string) []string {
 				currentTokens = 0
 			}
 
-			// If this paragraph itself exceeds 4096 tokens, split it
-			if int(paragraphTokens.TotalTokens) > 4096 {
+			// If this paragraph itself exceeds maxTokens tokens, split it
+			if int(paragraphTokens.TotalTokens) > maxTokens {
 				lines := strings.SplitAfter(paragraph, "\n")
 				for _, line := range lines {
 					lineTokens, _ := tok.CountTokens(genai.Text(line))
-					if int(lineTokens.TotalTokens) > 4096 {
+					if int(lineTokens.TotalTokens) > maxTokens {
 						// Split by rune count or "."
 						runes := []rune(line)
 						for len(runes) > 0 {
-							splitIndex := min(4096, len(runes))
+							splitIndex := min(maxTokens, len(runes))
 							for idx := range runes {
 								if runes[idx] == '.' ||
 									runes[idx] == '?' ||
@@ -65,7 +92,7 @@ func ChunkMarkdown(input string) []string {
 							runes = runes[splitIndex:]
 						}
 					} else {
-						if currentTokens+int(lineTokens.TotalTokens) > 4096 {
+						if currentTokens+int(lineTokens.TotalTokens) > maxTokens {
 							chunks = append(chunks, currentChunk.String())
 							currentChunk.Reset()
 							currentTokens = 0
@@ -90,7 +117,7 @@ func ChunkMarkdown(input string) []string {
 		chunks = append(chunks, currentChunk.String())
 	}
 
-	grouped := groupChunks(chunks, 4096)
+	grouped := groupChunks(chunks, maxTokens)
 
 	var finalChunks []string
 	for _, group := range grouped {
@@ -128,3 +155,79 @@ func groupChunks(chunks []string, maxTokens int) [][]string {
 
 	return groupedChunks
 }
+
+// SplitHalf splits s into two parts of roughly equal size, preferring paragraph breaks, then line
+// breaks, then sentence ends, then any rune boundary. Split points inside code blocks are only used
+// if there is no other, so that both parts are balanced markdown. Joining the parts yields s.
+// It returns false if s cannot be split.
+func SplitHalf(s string) (string, string, bool) {
+	mid := len(s) / 2
+	fences := fenceLines(s)
+
+	// inCodeBlock reports whether splitting at idx leaves a code block open in the left part.
+	inCodeBlock := func(idx int) bool {
+		open := false
+		for _, f := range fences {
+			if f[0] >= idx {
+				break
+			}
+			if idx < f[1] {
+				return true // inside the fence line itself
+			}
+			open = !open
+		}
+		return open
+	}
+
+	splitPoints := []func(idx int) bool{
+		// Paragraph breaks
+		func(idx int) bool { return idx >= 2 && s[idx-2:idx] == "\n\n" },
+		// Line breaks
+		func(idx int) bool { return s[idx-1] == '\n' },
+		// Sentence ends
+		func(idx int) bool { return idx >= 2 && strings.IndexByte(".?!;", s[idx-2]) >= 0 && s[idx-1] == ' ' },
+		// Any rune boundary
+		func(idx int) bool { return utf8.RuneStart(s[idx]) },
+	}
+	for _, allowCode := range []bool{false, true} {
+		for _, isSplitPoint := range splitPoints {
+			best := -1
+			for idx := 1; idx < len(s); idx++ {
+				if !isSplitPoint(idx) || (!allowCode && inCodeBlock(idx)) {
+					continue
+				}
+				if best == -1 || abs(idx-mid) < abs(best-mid) {
+					best = idx
+				}
+			}
+			if best != -1 {
+				return s[:best], s[best:], true
+			}
+		}
+	}
+
+	return s, "", false
+}
+
+// fenceLines returns the start and end offsets of the lines of s that open or close a code block.
+func fenceLines(s string) [][2]int {
+	var fences [][2]int
+	for offset := 0; offset < len(s); {
+		lineEnd := strings.IndexByte(s[offset:], '\n')
+		if lineEnd == -1 {
+			lineEnd = len(s) - offset
+		}
+		if strings.HasPrefix(strings.TrimSpace(s[offset:offset+lineEnd]), "```") {
+			fences = append(fences, [2]int{offset, offset + lineEnd})
+		}
+		offset += lineEnd + 1
+	}
+	return fences
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -220,3 +220,120 @@ Final paragraph to conclude the headers and tables test.`,
 		})
 	}
 }
+
+func TestSplitHalf(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		left  string
+	}{
+		{
+			name:  "paragraphs",
+			input: "first paragraph\n\nsecond paragraph\n\nthird paragraph\n\nfourth paragraph",
+			left:  "first paragraph\n\nsecond paragraph\n\n",
+		},
+		{
+			name:  "code block",
+			input: "intro\n\n```go\nfunc a() {}\n\nfunc b() {}\n```\n\noutro text that is long",
+			left:  "intro\n\n```go\nfunc a() {}\n\nfunc b() {}\n```\n\n",
+		},
+		{
+			name:  "lines outside a code block",
+			input: "intro line\n```go\nfunc a() {}\nfunc b() {}\nfunc c() {}\n```\n",
+			left:  "intro line\n",
+		},
+		{
+			name:  "only a code block",
+			input: "```go\nfunc a() {}\nfunc b() {}\n```",
+			left:  "```go\nfunc a() {}\n",
+		},
+		{
+			name:  "lines",
+			input: "line one\nline two\nline three\nline four",
+			left:  "line one\nline two\n",
+		},
+		{
+			name:  "sentences",
+			input: "One sentence. Two sentence. Three sentence. Four.",
+			left:  "One sentence. Two sentence. ",
+		},
+		{
+			name:  "runes",
+			input: "가나다라",
+			left:  "가나",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			left, right, ok := chunk.SplitHalf(tc.input)
+			if !ok {
+				t.Fatal("expected a split")
+			}
+			if left+right != tc.input {
+				t.Errorf("parts do not join to the input")
+			}
+			if left != tc.left {
+				t.Errorf("got left part %q, want %q", left, tc.left)
+			}
+		})
+	}
+
+	if _, _, ok := chunk.SplitHalf("a"); ok {
+		t.Errorf("a single rune must not be split")
+	}
+}
+
+func TestSplitThink(t *testing.T) {
+	text := func(s string) chunk.Block { return chunk.Block{Text: s, Kind: chunk.BlockText} }
+	tag := func(s string) chunk.Block { return chunk.Block{Text: s, Kind: chunk.BlockTag} }
+	reasoning := func(s string) chunk.Block { return chunk.Block{Text: s, Kind: chunk.BlockReasoning} }
+
+	testCases := []struct {
+		name  string
+		input string
+		want  []chunk.Block
+	}{
+		{
+			name:  "no tags",
+			input: "Just an answer.",
+			want:  []chunk.Block{text("Just an answer.")},
+		},
+		{
+			name:  "think block",
+			input: "<think>\nLet me think.\n</think>\n\nThe answer is 4.",
+			want:  []chunk.Block{tag("<think>"), reasoning("\nLet me think.\n"), tag("</think>"), text("\n\nThe answer is 4.")},
+		},
+		{
+			name:  "only closed",
+			input: "First, add the numbers.\n</think>\nIt is 4.",
+			want:  []chunk.Block{reasoning("First, add the numbers.\n"), tag("</think>"), text("\nIt is 4.")},
+		},
+		{
+			name:  "not closed",
+			input: "Answer: <think>still thinking",
+			want:  []chunk.Block{text("Answer: "), tag("<think>"), reasoning("still thinking")},
+		},
+		{
+			name:  "empty block",
+			input: "<think></think>Done.",
+			want:  []chunk.Block{tag("<think>"), tag("</think>"), text("Done.")},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := chunk.SplitThink(tc.input)
+			if fmt.Sprint(got) != fmt.Sprint(tc.want) {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+			var joined strings.Builder
+			for _, b := range got {
+				joined.WriteString(b.Text)
+			}
+			if joined.String() != tc.input {
+				t.Errorf("blocks do not join to the input")
+			}
+		})
+	}
+}
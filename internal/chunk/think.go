@@ -0,0 +1,67 @@
+package chunk
+
+import "strings"
+
+// Think tags enclose the reasoning of a model, e.g. "<think>...</think>".
+const (
+	ThinkOpen  = "<think>"
+	ThinkClose = "</think>"
+)
+
+// BlockKind is the kind of a Block.
+type BlockKind int
+
+const (
+	BlockText      BlockKind = iota // text outside of reasoning
+	BlockTag                        // a think tag
+	BlockReasoning                  // the content of a think block
+)
+
+// Block is a part of a document split at think tags.
+type Block struct {
+	Text string
+	Kind BlockKind
+}
+
+// SplitThink splits s into think tags, the reasoning between them and the text around them.
+// Joining the blocks yields s. A think block that is not closed runs to the end of s, and a
+// closing tag without an opening tag ends reasoning that starts at the beginning of s, as
+// DeepSeek-R1 writes it. Think tags within reasoning are part of the reasoning.
+func SplitThink(s string) []Block {
+	var blocks []Block
+	add := func(text string, kind BlockKind) {
+		if text != "" {
+			blocks = append(blocks, Block{Text: text, Kind: kind})
+		}
+	}
+
+	// Reasoning that is only closed.
+	if end := strings.Index(s, ThinkClose); end != -1 {
+		if start := strings.Index(s, ThinkOpen); start == -1 || start > end {
+			add(s[:end], BlockReasoning)
+			add(ThinkClose, BlockTag)
+			s = s[end+len(ThinkClose):]
+		}
+	}
+
+	for s != "" {
+		start := strings.Index(s, ThinkOpen)
+		if start == -1 {
+			add(s, BlockText)
+			break
+		}
+		add(s[:start], BlockText)
+		add(ThinkOpen, BlockTag)
+		s = s[start+len(ThinkOpen):]
+
+		end := strings.Index(s, ThinkClose)
+		if end == -1 {
+			add(s, BlockReasoning)
+			break
+		}
+		add(s[:end], BlockReasoning)
+		add(ThinkClose, BlockTag)
+		s = s[end+len(ThinkClose):]
+	}
+	return blocks
+}
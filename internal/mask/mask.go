@@ -0,0 +1,163 @@
+// Package mask replaces spans that must survive translation unchanged,
+// such as code, URLs and markup, with opaque tokens and restores them afterwards.
+package mask
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Kind selects the spans that are masked.
+type Kind uint
+
+const (
+	InlineCode  Kind = 1 << iota // `code`
+	URL                          // https://example.com/path
+	Email                        // user@example.com
+	Math                         // $x$, $$x$$, \(x\), \[x\]
+	HTML                         // <tag attr="v">, </tag>, <!-- comment -->
+	Placeholder                  // {name}, {{name}}
+
+	All = InlineCode | URL | Email | Math | HTML | Placeholder
+)
+
+const (
+	tokenPrefix = "⟦M"
+	tokenSuffix = "⟧"
+)
+
+var ErrTokenMismatch = errors.New("deeplingua: masked tokens were not preserved")
+
+var patterns = []struct {
+	kind Kind
+	expr string
+}{
+	{InlineCode, "``[^`\n]+``|`[^`\n]+`"},
+	{Math, `\$\$[\s\S]+?\$\$|\\\[[\s\S]+?\\\]|\\\([\s\S]+?\\\)|\$[^\s$](?:[^$\n]*[^\s$\\])?\$`},
+	{URL, `(?:https?|ftp)://[^\s<>()\[\]"'` + "`" + `]*[^\s<>()\[\]"'` + "`" + `.,;:!?]`},
+	{Email, `[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`},
+	{HTML, `<!--[\s\S]*?-->|</?[A-Za-z][A-Za-z0-9-]*(?:\s[^<>]*)?/?>`},
+	{Placeholder, `\{\{[^{}\n]+\}\}|\{[A-Za-z_][A-Za-z0-9_.-]*\}`},
+}
+
+var tokenRegexp = regexp.MustCompile(regexp.QuoteMeta(tokenPrefix) + `[0-9]+` + regexp.QuoteMeta(tokenSuffix))
+
+var regexpCache sync.Map // Kind -> *regexp.Regexp
+
+func compile(kinds Kind) *regexp.Regexp {
+	if re, ok := regexpCache.Load(kinds); ok {
+		return re.(*regexp.Regexp)
+	}
+
+	var re *regexp.Regexp
+	if expr := Expr(kinds); expr != "" {
+		re = regexp.MustCompile(expr)
+	}
+	regexpCache.Store(kinds, re)
+	return re
+}
+
+// Expr returns the regular expression matching the spans of the given kinds, or "" if there are none.
+func Expr(kinds Kind) string {
+	var exprs []string
+	for _, p := range patterns {
+		if kinds&p.kind != 0 {
+			exprs = append(exprs, p.expr)
+		}
+	}
+	return strings.Join(exprs, "|")
+}
+
+// Mapping remembers the spans replaced by Mask.
+type Mapping struct {
+	spans []string
+}
+
+// Mask replaces the spans of the given kinds in s with tokens.
+// Text that already contains something looking like a token is returned unchanged.
+func Mask(s string, kinds Kind) (string, *Mapping) {
+	m := &Mapping{}
+	re := compile(kinds & All)
+	if re == nil || tokenRegexp.MatchString(s) {
+		return s, m
+	}
+
+	var b strings.Builder
+	last := 0
+	for pos := 0; pos < len(s); {
+		loc := re.FindStringIndex(s[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		if currency(s, start, end) {
+			// Look for spans starting after the first $, e.g. the $10 of "$5-$10".
+			pos = start + 1
+			continue
+		}
+		m.spans = append(m.spans, s[start:end])
+		b.WriteString(s[last:start])
+		b.WriteString(token(len(m.spans)))
+		last, pos = end, end
+	}
+	b.WriteString(s[last:])
+	return b.String(), m
+}
+
+// currency reports whether the span s[start:end] is $x$ math followed by a digit,
+// which is an amount of money such as the "$5-$" of "$5-$10" rather than math.
+func currency(s string, start, end int) bool {
+	return strings.HasPrefix(s[start:], "$") && !strings.HasPrefix(s[start:], "$$") &&
+		end < len(s) && s[end] >= '0' && s[end] <= '9'
+}
+
+func token(n int) string {
+	return tokenPrefix + strconv.Itoa(n) + tokenSuffix
+}
+
+// Len returns the number of masked spans.
+func (m *Mapping) Len() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.spans)
+}
+
+// Restore replaces the tokens in s with the original spans.
+// Every token must occur exactly once; otherwise an error wrapping ErrTokenMismatch is returned.
+func (m *Mapping) Restore(s string) (string, error) {
+	if m.Len() == 0 {
+		return s, nil
+	}
+
+	counts := make([]int, len(m.spans))
+	var unknown []string
+	restored := tokenRegexp.ReplaceAllStringFunc(s, func(tok string) string {
+		n, _ := strconv.Atoi(tok[len(tokenPrefix) : len(tok)-len(tokenSuffix)])
+		if n < 1 || n > len(m.spans) {
+			unknown = append(unknown, tok)
+			return tok
+		}
+		counts[n-1]++
+		return m.spans[n-1]
+	})
+
+	var missing, duplicated []string
+	for i, c := range counts {
+		switch {
+		case c == 0:
+			missing = append(missing, token(i+1))
+		case c > 1:
+			duplicated = append(duplicated, token(i+1))
+		}
+	}
+	if len(missing) > 0 || len(duplicated) > 0 || len(unknown) > 0 {
+		return "", fmt.Errorf("%w (missing: %v, duplicated: %v, unknown: %v)", ErrTokenMismatch, missing, duplicated, unknown)
+	}
+
+	return restored, nil
+}
@@ -0,0 +1,104 @@
+package mask_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"gosuda.org/deeplingua/internal/mask"
+)
+
+func TestMaskRestore(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		spans []string
+	}{
+		{
+			name:  "inline code",
+			input: "Call `fmt.Println` to print.",
+			spans: []string{"`fmt.Println`"},
+		},
+		{
+			name:  "url and markdown link",
+			input: "See [docs](https://example.com/a?b=c) or https://go.dev.",
+			spans: []string{"https://example.com/a?b=c", "https://go.dev"},
+		},
+		{
+			name:  "email",
+			input: "Mail admin@example.com for access.",
+			spans: []string{"admin@example.com"},
+		},
+		{
+			name:  "math",
+			input: "We have $x^2$ and \\( a > 1 \\) and\n$$\n\\sum_i i\n$$",
+			spans: []string{"$x^2$", "\\( a > 1 \\)", "$$\n\\sum_i i\n$$"},
+		},
+		{
+			name:  "currency is not math",
+			input: "It costs $5 and $10 total.",
+		},
+		{
+			name:  "currency range is not math",
+			input: "It costs $5-$10, or $x$ per unit.",
+			spans: []string{"$x$"},
+		},
+		{
+			name:  "html and placeholders",
+			input: "<b>Hello</b> {name}, you have {{count}} messages.",
+			spans: []string{"<b>", "</b>", "{name}", "{{count}}"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			masked, m := mask.Mask(tc.input, mask.All)
+			if m.Len() != len(tc.spans) {
+				t.Fatalf("expected %d spans, got %d: %q", len(tc.spans), m.Len(), masked)
+			}
+			for _, span := range tc.spans {
+				if strings.Contains(masked, span) {
+					t.Errorf("span %q was not masked: %q", span, masked)
+				}
+			}
+
+			restored, err := m.Restore(masked)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if restored != tc.input {
+				t.Errorf("got %q, want %q", restored, tc.input)
+			}
+		})
+	}
+}
+
+func TestRestoreMismatch(t *testing.T) {
+	masked, m := mask.Mask("Use `a` and `b`.", mask.InlineCode)
+	if m.Len() != 2 {
+		t.Fatalf("expected 2 spans, got %d", m.Len())
+	}
+
+	missing := strings.Replace(masked, "⟦M2⟧", "", 1)
+	if _, err := m.Restore(missing); !errors.Is(err, mask.ErrTokenMismatch) {
+		t.Errorf("missing token: expected ErrTokenMismatch, got %v", err)
+	}
+
+	duplicated := masked + " ⟦M1⟧"
+	if _, err := m.Restore(duplicated); !errors.Is(err, mask.ErrTokenMismatch) {
+		t.Errorf("duplicated token: expected ErrTokenMismatch, got %v", err)
+	}
+
+	unknown := masked + " ⟦M7⟧"
+	if _, err := m.Restore(unknown); !errors.Is(err, mask.ErrTokenMismatch) {
+		t.Errorf("unknown token: expected ErrTokenMismatch, got %v", err)
+	}
+}
+
+func TestMaskKinds(t *testing.T) {
+	input := "`code` at https://example.com"
+	masked, m := mask.Mask(input, mask.URL)
+	if m.Len() != 1 || !strings.Contains(masked, "`code`") {
+		t.Errorf("only the URL should be masked, got %q", masked)
+	}
+}
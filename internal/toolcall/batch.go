@@ -0,0 +1,48 @@
+package toolcall
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var segmentPattern = regexp.MustCompile(`(?s)<segment-(\d+)>\n?(.*?)\n?</segment-(\d+)>`)
+
+// Batch joins texts into one document so that they are translated in a single request, each
+// wrapped in a numbered <segment-N> tag.
+func Batch(texts []string) string {
+	var sb strings.Builder
+	for i, text := range texts {
+		if i > 0 {
+			sb.WriteString("\n\n")
+		}
+		fmt.Fprintf(&sb, "<segment-%d>\n%s\n</segment-%d>", i+1, text, i+1)
+	}
+	return sb.String()
+}
+
+// Unbatch splits the translation of a Batch of n texts. Every segment must be present exactly once.
+func Unbatch(s string, n int) ([]string, error) {
+	texts := make([]string, n)
+	found := make([]bool, n)
+	for _, m := range segmentPattern.FindAllStringSubmatch(s, -1) {
+		if m[1] != m[3] {
+			return nil, fmt.Errorf("deeplingua: segment %s is closed by segment %s", m[1], m[3])
+		}
+		i, _ := strconv.Atoi(m[1])
+		if i < 1 || i > n {
+			return nil, fmt.Errorf("deeplingua: unexpected segment %d", i)
+		}
+		if found[i-1] {
+			return nil, fmt.Errorf("deeplingua: segment %d is repeated", i)
+		}
+		texts[i-1], found[i-1] = m[2], true
+	}
+	for i, ok := range found {
+		if !ok {
+			return nil, fmt.Errorf("deeplingua: segment %d is missing", i+1)
+		}
+	}
+	return texts, nil
+}
@@ -0,0 +1,168 @@
+package toolcall
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// Schema is the part of a JSON schema that tool parameters are checked against.
+type Schema struct {
+	Type       typeList           `json:"type,omitempty"`
+	Format     string             `json:"format,omitempty"`
+	Enum       []any              `json:"enum,omitempty"`
+	Properties map[string]*Schema `json:"properties,omitempty"`
+	Items      *Schema            `json:"items,omitempty"`
+	Required   []string           `json:"required,omitempty"`
+}
+
+// property returns the schema of the value at path below s, or nil if it is unknown.
+func (s *Schema) property(path []string) *Schema {
+	for _, key := range path {
+		if s == nil {
+			return nil
+		}
+		if key == "[]" {
+			s = s.Items
+		} else {
+			s = s.Properties[key]
+		}
+	}
+	return s
+}
+
+// fixed reports whether string values of s must not be translated.
+func (s *Schema) fixed() bool {
+	return s != nil && (len(s.Enum) > 0 || s.Format != "" || !s.Type.allows("string"))
+}
+
+// typeList is the "type" of a schema, which is either a single type or a list of types.
+type typeList []string
+
+func (t *typeList) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*t = typeList{one}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(t))
+}
+
+// allows reports whether values of type typ are allowed. Any type is allowed if there is no list.
+func (t typeList) allows(typ string) bool {
+	return len(t) == 0 || slices.Contains(t, typ)
+}
+
+// Tool is a function the model may call.
+type Tool struct {
+	Name       string  `json:"name"`
+	Parameters *Schema `json:"parameters,omitempty"`
+}
+
+// Tools are the tools of a conversation by name.
+type Tools map[string]*Tool
+
+// ParseTools reads tool definitions from s: a JSON array or a sequence of JSON objects, each
+// either a tool or an OpenAI style {"type": "function", "function": tool} wrapper.
+func ParseTools(s string) (Tools, error) {
+	tools := make(Tools)
+	dec := json.NewDecoder(strings.NewReader(s))
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return tools, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		defs := []json.RawMessage{raw}
+		if strings.HasPrefix(strings.TrimSpace(string(raw)), "[") {
+			defs = nil
+			if err := json.Unmarshal(raw, &defs); err != nil {
+				return nil, err
+			}
+		}
+		for _, def := range defs {
+			var t struct {
+				Tool
+				Function *Tool `json:"function,omitempty"`
+			}
+			if err := json.Unmarshal(def, &t); err != nil {
+				return nil, err
+			}
+			tool := &t.Tool
+			if t.Function != nil {
+				tool = t.Function
+			}
+			if tool.Name != "" {
+				tools[tool.Name] = tool
+			}
+		}
+	}
+}
+
+// Add adds the tools of o to t.
+func (t Tools) Add(o Tools) {
+	for name, tool := range o {
+		t[name] = tool
+	}
+}
+
+// call is a tool call as written in a <tool_call> block.
+type call struct {
+	Name      string         `json:"name"`
+	Arguments map[string]any `json:"arguments"`
+}
+
+var errNotACall = errors.New("not a tool call")
+
+// checkCall returns every way the tool call in block breaks the schema of its tool, sorted.
+// It returns errNotACall if block is not a tool call.
+func (t Tools) checkCall(block string) ([]string, error) {
+	var c call
+	if err := json.Unmarshal([]byte(block), &c); err != nil || c.Name == "" {
+		return nil, errNotACall
+	}
+	tool, ok := t[c.Name]
+	if !ok {
+		if len(t) > 0 {
+			return []string{fmt.Sprintf("unknown tool %q", c.Name)}, nil
+		}
+		return nil, nil
+	}
+	var problems []string
+	checkValue("arguments", c.Arguments, tool.Parameters, &problems)
+	slices.Sort(problems)
+	return problems, nil
+}
+
+func checkValue(path string, v any, s *Schema, problems *[]string) {
+	if s == nil {
+		return
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return fmt.Sprint(e) == fmt.Sprint(v) }) {
+		*problems = append(*problems, fmt.Sprintf("%s: %v is not one of %v", path, v, s.Enum))
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		for _, key := range s.Required {
+			if _, ok := v[key]; !ok {
+				*problems = append(*problems, fmt.Sprintf("%s: required %q is missing", path, key))
+			}
+		}
+		for key, value := range v {
+			checkValue(path+"."+key, value, s.Properties[key], problems)
+		}
+	case []any:
+		for i, value := range v {
+			checkValue(fmt.Sprintf("%s[%d]", path, i), value, s.Items, problems)
+		}
+	case string:
+		if !s.Type.allows("string") {
+			*problems = append(*problems, fmt.Sprintf("%s: expected %s, got a string", path, strings.Join(s.Type, " or ")))
+		}
+	}
+}
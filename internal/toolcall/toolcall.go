@@ -0,0 +1,293 @@
+// Package toolcall finds the natural language in messages with tool definitions, tool calls
+// and tool results, so that it can be translated without touching keys, function names or enums.
+package toolcall
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gosuda.org/deeplingua/langid"
+)
+
+// Kinds of tool blocks.
+const (
+	KindTools    = "tools"         // tool definitions
+	KindCall     = "tool_call"     // a call of a tool
+	KindResponse = "tool_response" // the result of a tool call
+)
+
+var blockPattern = regexp.MustCompile(`<(tools|tool_call|tool_response)>([\s\S]*?)</(tools|tool_call|tool_response)>`)
+
+// Document is a message split into free text and tool blocks.
+type Document struct {
+	parts    []part
+	tools    Tools
+	response bool // the whole document is a tool result without tags
+}
+
+type part struct {
+	text  string // raw text of the part
+	kind  string // "" for free text, otherwise the kind of the tool block
+	json  bool   // the block is JSON and its slots are JSON strings
+	slots []slot // translatable spans of text, in order
+
+	problems []string // schema problems of the source tool call, which the translation may keep
+}
+
+// slot is a translatable span of a part.
+type slot struct {
+	start, end int
+	value      string // decoded text of the span
+}
+
+// Parse splits content into free text and tool blocks. Tool calls are checked against tools,
+// which may be nil. With response set, content that is JSON is the result of a tool call as a
+// whole, as in messages of the "tool" role.
+func Parse(content string, tools Tools, response bool) *Document {
+	d := &Document{tools: tools}
+	if response && json.Valid([]byte(content)) {
+		d.response = true
+		d.parts = append(d.parts, newBlock(KindResponse, content, tools))
+		return d
+	}
+
+	last := 0
+	for _, m := range blockPattern.FindAllStringSubmatchIndex(content, -1) {
+		kind, closing := content[m[2]:m[3]], content[m[6]:m[7]]
+		if kind != closing {
+			continue
+		}
+		d.parts = append(d.parts, newText(content[last:m[0]]))
+		d.parts = append(d.parts, newBlock(kind, content[m[4]:m[5]], tools))
+		last = m[1]
+	}
+	d.parts = append(d.parts, newText(content[last:]))
+	return d
+}
+
+// newText returns a free text part. Its text is translated as a whole, keeping the surrounding
+// whitespace and any tags outside of it.
+func newText(text string) part {
+	p := part{text: text}
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" || langid.Detect(trimmed).NoText {
+		return p
+	}
+	start := strings.Index(text, trimmed)
+	p.slots = []slot{{start: start, end: start + len(trimmed), value: trimmed}}
+	return p
+}
+
+// newBlock returns a tool block part. Only string values holding natural language are translated.
+// A block that is not JSON is kept unchanged.
+func newBlock(kind, text string, tools Tools) part {
+	p := part{text: text, kind: kind}
+	strs, err := jsonStrings(text)
+	if err != nil {
+		return p
+	}
+	p.json = true
+
+	var schema *Schema
+	if kind == KindCall {
+		var c call
+		if json.Unmarshal([]byte(text), &c) == nil {
+			if tool, ok := tools[c.Name]; ok {
+				schema = tool.Parameters
+			}
+		}
+		p.problems, _ = tools.checkCall(text)
+	}
+
+	for _, s := range strs {
+		if s.key || !naturalLanguage(s.value) {
+			continue
+		}
+		switch kind {
+		case KindTools:
+			// Only descriptions; names, types and enums stay as they are.
+			if len(s.path) == 0 || s.path[len(s.path)-1] != "description" {
+				continue
+			}
+		case KindCall:
+			if len(s.path) < 2 || s.path[0] != "arguments" || schema.property(s.path[1:]).fixed() {
+				continue
+			}
+		}
+		p.slots = append(p.slots, slot{start: s.start, end: s.end, value: s.value})
+	}
+	return p
+}
+
+// naturalLanguage reports whether s looks like a phrase of natural language rather than an
+// identifier, a name or a value such as a date or a URL.
+func naturalLanguage(s string) bool {
+	return len(strings.Fields(s)) >= 3 && !langid.Detect(s).NoText
+}
+
+// HasTools reports whether the document has a tool block.
+func (d *Document) HasTools() bool {
+	return slices.ContainsFunc(d.parts, func(p part) bool { return p.kind != "" })
+}
+
+// Definitions returns the tools defined in the <tools> blocks of the document.
+// Blocks that are not tool definitions are ignored.
+func (d *Document) Definitions() Tools {
+	tools := make(Tools)
+	for _, p := range d.parts {
+		if p.kind != KindTools {
+			continue
+		}
+		if defined, err := ParseTools(p.text); err == nil {
+			tools.Add(defined)
+		}
+	}
+	return tools
+}
+
+// Texts returns the texts to translate, in order.
+func (d *Document) Texts() []string {
+	var texts []string
+	for _, p := range d.parts {
+		for _, s := range p.slots {
+			texts = append(texts, s.value)
+		}
+	}
+	return texts
+}
+
+// Render returns the document with the texts replaced by translations, in the order of Texts.
+// Every JSON block must still parse and no tool call may break the schema of its tool in a way
+// its source did not.
+func (d *Document) Render(translations []string) (string, error) {
+	if n := len(d.Texts()); len(translations) != n {
+		return "", fmt.Errorf("deeplingua: got %d translations for %d texts", len(translations), n)
+	}
+
+	var sb strings.Builder
+	for _, p := range d.parts {
+		text := p.text
+		slots := p.slots
+		replaced := translations[:len(slots)]
+		translations = translations[len(slots):]
+		for i := len(slots) - 1; i >= 0; i-- {
+			value := replaced[i]
+			if p.json {
+				value = encodeString(value)
+			}
+			text = text[:slots[i].start] + value + text[slots[i].end:]
+		}
+
+		if p.json {
+			if !json.Valid([]byte(text)) {
+				return "", fmt.Errorf("deeplingua: translated %s block is not valid JSON", p.kind)
+			}
+			if p.kind == KindCall {
+				problems, err := d.tools.checkCall(text)
+				if err != nil && !errors.Is(err, errNotACall) {
+					return "", fmt.Errorf("deeplingua: translated tool call: %w", err)
+				}
+				for _, problem := range problems {
+					if !slices.Contains(p.problems, problem) {
+						return "", fmt.Errorf("deeplingua: translated tool call: %s", problem)
+					}
+				}
+			}
+		}
+		if p.kind != "" && !d.response {
+			text = "<" + p.kind + ">" + text + "</" + p.kind + ">"
+		}
+		sb.WriteString(text)
+	}
+	return sb.String(), nil
+}
+
+func encodeString(s string) string {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// jsonString is a string in a JSON text.
+type jsonString struct {
+	start, end int      // span of the string including its quotes
+	value      string   // decoded string
+	path       []string // keys of the enclosing objects, "[]" for array elements
+	key        bool     // the string is an object key
+}
+
+// frame is an open JSON object or array. key is the key of the value being read in an object.
+type frame struct {
+	object  bool
+	wantKey bool
+	key     string
+}
+
+// framePath returns the keys of the open objects, with "[]" for arrays.
+func framePath(stack []frame) []string {
+	p := make([]string, len(stack))
+	for i, f := range stack {
+		p[i] = "[]"
+		if f.object {
+			p[i] = f.key
+		}
+	}
+	return p
+}
+
+// jsonStrings returns every string of the JSON values in text, which may hold several values.
+func jsonStrings(text string) ([]jsonString, error) {
+	dec := json.NewDecoder(strings.NewReader(text))
+	var strs []jsonString
+	var stack []frame
+	values := 0
+	for {
+		offset := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case json.Delim:
+			if tok == '{' || tok == '[' {
+				stack = append(stack, frame{object: tok == '{', wantKey: tok == '{'})
+				continue
+			}
+			stack = stack[:len(stack)-1]
+		case string:
+			end := int(dec.InputOffset())
+			start := offset + strings.IndexByte(text[offset:end], '"')
+			s := jsonString{start: start, end: end, value: tok, path: framePath(stack)}
+			if n := len(stack); n > 0 && stack[n-1].wantKey {
+				s.key = true
+				strs = append(strs, s)
+				stack[n-1].key, stack[n-1].wantKey = tok, false
+				continue
+			}
+			strs = append(strs, s)
+		}
+
+		// A value was read: the enclosing object expects a key again.
+		if n := len(stack); n == 0 {
+			values++
+		} else if stack[n-1].object {
+			stack[n-1].wantKey = true
+		}
+	}
+	if values == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	return strs, nil
+}
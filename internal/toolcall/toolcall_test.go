@@ -0,0 +1,176 @@
+package toolcall_test
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"gosuda.org/deeplingua/internal/toolcall"
+)
+
+const weatherTools = `[{"type": "function", "function": {
+	"name": "get_weather",
+	"description": "Get the current weather for a city.",
+	"parameters": {
+		"type": "object",
+		"properties": {
+			"city": {"type": "string", "description": "The name of the city to look up."},
+			"unit": {"type": "string", "enum": ["celsius", "fahrenheit"], "description": "The unit of the temperature."},
+			"note": {"type": "string", "description": "A message shown to the user."}
+		},
+		"required": ["city", "unit"]
+	}
+}}]`
+
+func mustParseTools(t *testing.T, s string) toolcall.Tools {
+	t.Helper()
+	tools, err := toolcall.ParseTools(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tools
+}
+
+func upper(texts []string) []string {
+	out := make([]string, len(texts))
+	for i, text := range texts {
+		out[i] = strings.ToUpper(text)
+	}
+	return out
+}
+
+func TestParseCall(t *testing.T) {
+	tools := mustParseTools(t, weatherTools)
+	content := "Let me check the weather for you.\n<tool_call>\n" +
+		`{"name": "get_weather", "arguments": {"city": "San Francisco", "unit": "celsius", "note": "Bring an umbrella <today> & tomorrow"}}` +
+		"\n</tool_call>"
+
+	doc := toolcall.Parse(content, tools, false)
+	want := []string{"Let me check the weather for you.", "Bring an umbrella <today> & tomorrow"}
+	if got := doc.Texts(); !slices.Equal(got, want) {
+		t.Fatalf("Texts() = %q, want %q", got, want)
+	}
+
+	got, err := doc.Render(upper(doc.Texts()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantContent := "LET ME CHECK THE WEATHER FOR YOU.\n<tool_call>\n" +
+		`{"name": "get_weather", "arguments": {"city": "San Francisco", "unit": "celsius", "note": "BRING AN UMBRELLA <TODAY> & TOMORROW"}}` +
+		"\n</tool_call>"
+	if got != wantContent {
+		t.Errorf("Render() = %q, want %q", got, wantContent)
+	}
+}
+
+func TestParseTools(t *testing.T) {
+	content := "You are a helpful assistant with access to these tools.\n<tools>\n" + weatherTools + "\n</tools>"
+	doc := toolcall.Parse(content, nil, false)
+	want := []string{
+		"You are a helpful assistant with access to these tools.",
+		"Get the current weather for a city.",
+		"The name of the city to look up.",
+		"The unit of the temperature.",
+		"A message shown to the user.",
+	}
+	if got := doc.Texts(); !slices.Equal(got, want) {
+		t.Fatalf("Texts() = %q, want %q", got, want)
+	}
+
+	got, err := doc.Render(upper(want))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tools := mustParseTools(t, got[strings.Index(got, "["):strings.LastIndex(got, "]")+1])
+	if tool := tools["get_weather"]; tool == nil || tool.Parameters.Properties["unit"].Enum[0] != "celsius" {
+		t.Errorf("names and enums of tools changed: %s", got)
+	}
+}
+
+func TestParseResponse(t *testing.T) {
+	content := `{"temperature": 18, "condition": "partly_cloudy", "summary": "Mild with a light breeze.", "tags": ["Clouds move in from the west."]}`
+	doc := toolcall.Parse(content, nil, true)
+	want := []string{"Mild with a light breeze.", "Clouds move in from the west."}
+	if got := doc.Texts(); !slices.Equal(got, want) {
+		t.Fatalf("Texts() = %q, want %q", got, want)
+	}
+	got, err := doc.Render([]string{`Mild "and" breezy.`, "Clouds."})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v map[string]any
+	if err := json.Unmarshal([]byte(got), &v); err != nil {
+		t.Fatalf("Render() = %q is not JSON: %v", got, err)
+	}
+	if v["summary"] != `Mild "and" breezy.` || v["condition"] != "partly_cloudy" {
+		t.Errorf("Render() = %q", got)
+	}
+}
+
+func TestParseNotJSON(t *testing.T) {
+	content := "<tool_call>\nget_weather(city=\"Paris and Lyon\")\n</tool_call>"
+	doc := toolcall.Parse(content, nil, false)
+	if texts := doc.Texts(); len(texts) != 0 {
+		t.Errorf("Texts() = %q, want none", texts)
+	}
+	if got, err := doc.Render(nil); err != nil || got != content {
+		t.Errorf("Render() = %q, %v, want the content unchanged", got, err)
+	}
+}
+
+func TestCheckCall(t *testing.T) {
+	tools := mustParseTools(t, weatherTools)
+	schema := tools["get_weather"].Parameters
+	schema.Properties["city"].Enum = []any{"San Francisco", "Paris"}
+	content := `<tool_call>{"name": "get_weather", "arguments": {"city": "Paris", "unit": "celsius", "note": "Stay dry out there."}}</tool_call>`
+
+	doc := toolcall.Parse(content, tools, false)
+	if _, err := doc.Render([]string{"Reste au sec."}); err != nil {
+		t.Errorf("Render() error = %v", err)
+	}
+
+	schema.Properties["note"] = &toolcall.Schema{Type: []string{"integer"}}
+	if _, err := doc.Render([]string{"Reste au sec."}); err == nil {
+		t.Error("Render() succeeded for a call that does not match the schema")
+	}
+}
+
+func TestBatch(t *testing.T) {
+	texts := []string{"First line.\n\nSecond paragraph.", "Another text."}
+	batch := toolcall.Batch(texts)
+	got, err := toolcall.Unbatch(batch, len(texts))
+	if err != nil || !slices.Equal(got, texts) {
+		t.Errorf("Unbatch(Batch()) = %q, %v, want %q", got, err, texts)
+	}
+	if _, err := toolcall.Unbatch("<segment-1>\nOnly one.\n</segment-1>", 2); err == nil {
+		t.Error("Unbatch() succeeded with a missing segment")
+	}
+}
+
+func TestDefinitions(t *testing.T) {
+	system := "You can call functions.\n<tools>\n" + weatherTools + "\n</tools>"
+	doc := toolcall.Parse(system, nil, false)
+	if !doc.HasTools() {
+		t.Fatal("HasTools() = false")
+	}
+	if _, ok := doc.Definitions()["get_weather"]; !ok {
+		t.Errorf("Definitions() = %v, want get_weather", doc.Definitions())
+	}
+	if doc := toolcall.Parse("No tools in this message at all.", nil, true); doc.HasTools() {
+		t.Error("HasTools() = true for a message without tools")
+	}
+}
+
+func TestCheckCallBrokenSource(t *testing.T) {
+	tools := mustParseTools(t, weatherTools)
+	// The source already misses the required unit and calls an unknown tool; the translation keeps
+	// those problems and must still be accepted.
+	content := `<tool_call>{"name": "get_weather", "arguments": {"city": "Paris", "note": "Stay dry out there."}}</tool_call>` +
+		`<tool_call>{"name": "get_forecast", "arguments": {"note": "Plan for the whole week."}}</tool_call>`
+
+	doc := toolcall.Parse(content, tools, false)
+	if _, err := doc.Render([]string{"Reste au sec.", "Prévois toute la semaine."}); err != nil {
+		t.Errorf("Render() error = %v", err)
+	}
+}
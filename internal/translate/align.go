@@ -0,0 +1,91 @@
+package translate
+
+import "strings"
+
+// Segment is a part of the source document aligned with its translation.
+// The offsets are byte offsets into the source text and into Result.Text.
+type Segment struct {
+	Source           string `json:"source"`
+	Translation      string `json:"translation"`
+	SourceStart      int    `json:"source_start"`
+	SourceEnd        int    `json:"source_end"`
+	TranslationStart int    `json:"translation_start"`
+	TranslationEnd   int    `json:"translation_end"`
+}
+
+// alignedPair is a source text and its translation, before offsets are assigned.
+type alignedPair struct {
+	source      string
+	translation string
+}
+
+// pairsOf returns the aligned parts of the translation of source. A chunk that was split
+// after truncated output has one pair per piece.
+func (r chunkResult) pairsOf(source string) []alignedPair {
+	if len(r.pairs) > 0 {
+		return r.pairs
+	}
+	return []alignedPair{{source: source, translation: r.text}}
+}
+
+// segments assigns the offsets of consecutive pairs.
+func segments(pairs []alignedPair) []Segment {
+	segs := make([]Segment, len(pairs))
+	var src, dst int
+	for i, p := range pairs {
+		segs[i] = Segment{
+			Source:           p.source,
+			Translation:      p.translation,
+			SourceStart:      src,
+			SourceEnd:        src + len(p.source),
+			TranslationStart: dst,
+			TranslationEnd:   dst + len(p.translation),
+		}
+		src, dst = segs[i].SourceEnd, segs[i].TranslationEnd
+	}
+	return segs
+}
+
+// Paragraphs refines the segments of r into paragraphs. A segment is split only if its source and
+// its translation have the same number of paragraphs; otherwise it is kept whole.
+// Paragraphs inside code fences are not split.
+func (r *Result) Paragraphs() []Segment {
+	var pairs []alignedPair
+	for _, seg := range r.Segments {
+		src, dst := paragraphs(seg.Source), paragraphs(seg.Translation)
+		if len(src) != len(dst) {
+			pairs = append(pairs, alignedPair{source: seg.Source, translation: seg.Translation})
+			continue
+		}
+		for i := range src {
+			pairs = append(pairs, alignedPair{source: src[i], translation: dst[i]})
+		}
+	}
+	return segments(pairs)
+}
+
+// paragraphs splits s after every blank line outside code fences. Joining the paragraphs yields s.
+func paragraphs(s string) []string {
+	var paras []string
+	inFence := false
+	start := 0
+	lines := strings.SplitAfter(s, "\n")
+	offset := 0
+	for i, line := range lines {
+		offset += len(line)
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		// A paragraph ends after a run of blank lines followed by a non-blank line.
+		if !inFence && strings.TrimSpace(line) == "" && i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+			if strings.TrimSpace(s[start:offset]) != "" {
+				paras = append(paras, s[start:offset])
+				start = offset
+			}
+		}
+	}
+	if start < len(s) {
+		paras = append(paras, s[start:])
+	}
+	return paras
+}
@@ -0,0 +1,43 @@
+package translate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+
+	"gosuda.org/deeplingua/internal/mask"
+	"gosuda.org/deeplingua/normalize"
+)
+
+// Cache stores accepted chunk translations, so that repeated chunks and re-runs
+// do not call the model again. The internal/cache package provides an on-disk Cache.
+type Cache interface {
+	Get(key string) (string, bool)
+	Put(key string, translation string) error
+}
+
+// cacheKey addresses the translation of a chunk by its normalized text and the inputs that
+// decide it: the languages, register, domain, instructions, glossary entries, masked kinds and
+// prompt template. The surrounding chunks and conversation turns are left out, so that a chunk
+// is reused across documents. model is empty if the cache is shared by all models.
+func cacheKey(text string, data PromptData, template string, masking mask.Kind, model string) string {
+	h := sha256.New()
+	for _, field := range []string{
+		normalize.Normalize(text),
+		data.SourceLanguage,
+		data.TargetLanguage,
+		data.Register,
+		strings.Join(data.RegisterExamples, "\n"),
+		data.Domain,
+		data.Instructions,
+		data.Glossary,
+		strconv.FormatUint(uint64(masking), 10),
+		template,
+		model,
+	} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,153 @@
+package translate
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lemon-mint/coord/llm"
+)
+
+// Candidate is one of several translations of a chunk.
+type Candidate struct {
+	Text       string      `json:"text"`
+	Model      string      `json:"model"`
+	Score      float64     `json:"score"`
+	Violations []Violation `json:"violations,omitempty"`
+	Usage      ModelUsage  `json:"usage,omitempty"` // tokens used to score the candidate, set by the Scorer
+}
+
+// Selection records the candidates of a chunk and which of them was chosen,
+// e.g. to build chosen/rejected pairs for preference training.
+type Selection struct {
+	Chunk      int         `json:"chunk"`
+	Source     string      `json:"source"`
+	Candidates []Candidate `json:"candidates"`
+	Chosen     int         `json:"chosen"`
+}
+
+// Scorer scores a candidate translation of a chunk. Higher is better.
+type Scorer interface {
+	Score(ctx context.Context, params *Request, source string, c *Candidate) (float64, error)
+}
+
+// ViolationScorer prefers candidates with fewer validation violations.
+// It runs locally and is the default Scorer.
+type ViolationScorer struct{}
+
+func (ViolationScorer) Score(ctx context.Context, params *Request, source string, c *Candidate) (float64, error) {
+	return 1 / float64(1+len(c.Violations)), nil
+}
+
+// JudgeScorer scores candidates with an LLM judge. Candidates with validation violations
+// are scored as if the judge gave them 0.
+type JudgeScorer struct {
+	Evaluator Evaluator
+}
+
+func (s JudgeScorer) Score(ctx context.Context, params *Request, source string, c *Candidate) (float64, error) {
+	if len(c.Violations) > 0 {
+		return 0, nil
+	}
+	evaluation, err := s.Evaluator.Evaluate(ctx, params.SourceLanguage, params.TargetLanguage, source, c.Text)
+	if evaluation != nil {
+		c.Usage = ModelUsage{evaluation.Model: usageOf(evaluation.Usage)}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return evaluation.Score, nil
+}
+
+// translateChunkBest translates a chunk, or with candidates enabled translates it several times
+// and keeps the candidate with the highest score. Fixed chunks are returned unchanged.
+func (t *Translator) translateChunkBest(ctx context.Context, req chunkRequest) (chunkResult, error) {
+	if req.kind == chunkFixed {
+		return chunkResult{text: req.text}, nil
+	}
+	if t.candidates < 2 {
+		return t.translateChunkRetry(ctx, req)
+	}
+
+	// The chosen candidate is cached under the key of the translator's model,
+	// so that a cached chunk is not translated n times again.
+	var key string
+	if t.cache != nil {
+		model := t.requestModel(req)
+		_, mapping := t.maskChunk(req)
+		data, tmpl := t.buildPrompt(model, req, mapping.Len() > 0)
+		key = t.chunkCacheKey(req, model, data, tmpl)
+		if key != "" {
+			if text, ok := t.cache.Get(key); ok && len(t.validate(req, text)) == 0 {
+				return chunkResult{text: text, prompts: []string{tmpl.ID()}, cached: 1, model: model.Name()}, nil
+			}
+		}
+	}
+
+	results := make([]chunkResult, t.candidates)
+	errs := make([]error, t.candidates)
+	var wg sync.WaitGroup
+	for i := range t.candidates {
+		r := req
+		r.candidate = true
+		if len(t.candidateModels) > 0 {
+			r.model = t.candidateModels[i%len(t.candidateModels)]
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = t.translateChunkRetry(ctx, r)
+		}()
+	}
+	wg.Wait()
+
+	selection := Selection{Chunk: req.index, Source: req.text, Chosen: -1}
+	var chosen chunkResult
+	usage := make(ModelUsage)
+	for i := range results {
+		usage.Merge(results[i].usage)
+		if errs[i] != nil {
+			continue
+		}
+		c := Candidate{Text: results[i].text, Model: results[i].model, Violations: results[i].violations}
+		score, err := t.scorer.Score(ctx, req.params, req.text, &c)
+		if err != nil {
+			t.logger.Error().Err(err).Int("chunk", req.index).Int("candidate", i).Msg("failed to score candidate")
+		}
+		c.Score = score
+		for model, u := range c.Usage {
+			usage.Merge(t.recordUsage(model, u))
+		}
+		selection.Candidates = append(selection.Candidates, c)
+		if selection.Chosen == -1 || score > selection.Candidates[selection.Chosen].Score {
+			selection.Chosen = len(selection.Candidates) - 1
+			chosen = results[i]
+		}
+	}
+	if selection.Chosen == -1 {
+		return chunkResult{usage: usage}, errs[0]
+	}
+	chosen.usage = usage
+
+	if len(chosen.violations) == 0 && key != "" {
+		if err := t.cache.Put(key, chosen.text); err != nil {
+			t.logger.Error().Err(err).Int("chunk", req.index).Msg("failed to cache translation")
+		}
+	}
+	if t.keepCandidates {
+		chosen.selections = append(chosen.selections, selection)
+	}
+	return chosen, nil
+}
+
+// requestModel returns the model that handles req.
+func (t *Translator) requestModel(req chunkRequest) llm.Model {
+	model := t.model
+	if req.model != nil {
+		model = req.model
+	}
+	if p, ok := model.(ModelPicker); ok {
+		model = p.Pick()
+	}
+	return model
+}
@@ -0,0 +1,255 @@
+package translate
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gosuda.org/deeplingua/internal/mask"
+)
+
+// EntityKind selects the entities checked by EntityValidator.
+type EntityKind uint
+
+const (
+	EntityURL        EntityKind = 1 << iota // https://example.com/path
+	EntityEmail                             // user@example.com
+	EntityVersion                           // v1.2, 1.2.3
+	EntityDate                              // 2024-03-05, 3/5/2024, March 5, 2024
+	EntityCurrency                          // $1,000, 30 EUR
+	EntityNumber                            // 1,000.5, 42%
+	EntityProperNoun                        // DeepLingua, GPU, Seoul
+
+	EntityAll = EntityURL | EntityEmail | EntityVersion | EntityDate | EntityCurrency | EntityNumber | EntityProperNoun
+
+	// EntityDefault leaves out proper nouns, which are routinely transliterated into languages
+	// such as Korean or Japanese ("Seoul" becomes "서울").
+	EntityDefault = EntityAll &^ EntityProperNoun
+)
+
+var entityNames = map[EntityKind]string{
+	EntityURL:        "URL",
+	EntityEmail:      "e-mail address",
+	EntityVersion:    "version",
+	EntityDate:       "date",
+	EntityCurrency:   "currency amount",
+	EntityNumber:     "number",
+	EntityProperNoun: "proper noun",
+}
+
+func (k EntityKind) String() string {
+	return entityNames[k]
+}
+
+// EntityValidator checks that the entities of a source chunk appear in its translation.
+// URLs, e-mail addresses, versions and proper nouns must appear unchanged. Dates, currency
+// amounts and numbers may be reformatted as long as their digits survive, so "2024-03-05"
+// may become "2024년 3월 5일" and "1,000.5" may become "1.000,5".
+//
+// Single digits and numbers followed by a scale word such as "million" are not checked,
+// since translations commonly spell or regroup them. EntityProperNoun suits targets that keep
+// names in Latin script; sources in languages that capitalize every noun, such as German,
+// should leave it out.
+type EntityValidator struct {
+	Kinds EntityKind // EntityDefault if 0
+}
+
+func (v EntityValidator) Validate(source, translated string) []Violation {
+	kinds := v.Kinds
+	if kinds == 0 {
+		kinds = EntityDefault
+	}
+
+	numbers := numberSet(translated)
+	var violations []Violation
+	seen := make(map[string]bool)
+	for _, e := range findEntities(source, kinds) {
+		if seen[e.text] {
+			continue
+		}
+		seen[e.text] = true
+
+		var ok bool
+		switch e.kind {
+		case EntityURL, EntityEmail, EntityVersion:
+			ok = strings.Contains(translated, e.text)
+		case EntityProperNoun:
+			ok = containsTerm(translated, e.text)
+		case EntityDate:
+			ok = true
+			for _, n := range digitRuns.FindAllString(e.text, -1) {
+				ok = ok && numbers[normalizeNumber(n)]
+			}
+		case EntityCurrency, EntityNumber:
+			ok = numbers[normalizeNumber(numberPattern.FindString(e.text))]
+		}
+		if !ok {
+			violations = append(violations, Violation{
+				Rule:    "entity",
+				Message: e.kind.String() + " " + strconv.Quote(e.text) + " is missing",
+			})
+		}
+	}
+	return violations
+}
+
+type entity struct {
+	kind EntityKind
+	text string
+}
+
+const (
+	numberExpr = `\d+(?:[.,]\d+)*`
+	monthExpr  = `(?:Jan(?:uary)?|Feb(?:ruary)?|Mar(?:ch)?|Apr(?:il)?|May|June?|July?|Aug(?:ust)?|Sep(?:t(?:ember)?)?|Oct(?:ober)?|Nov(?:ember)?|Dec(?:ember)?)\.?`
+	scaleExpr  = `(?:[ \t]+(?:thousand|million|billion|trillion)\b)?`
+)
+
+// entityPattern matches every entity, trying the kinds in the order of the groups.
+var entityPattern = regexp.MustCompile(strings.Join([]string{
+	`(?P<url>` + mask.Expr(mask.URL) + `)`,
+	`(?P<email>` + mask.Expr(mask.Email) + `)`,
+	`(?P<date>\b\d{4}[-/]\d{1,2}[-/]\d{1,2}\b|\b\d{1,2}[/.]\d{1,2}[/.]\d{4}\b|\b` + monthExpr + `[ \t]+\d{1,2}(?:st|nd|rd|th)?,?[ \t]+\d{4}\b|\b\d{1,2}[ \t]+` + monthExpr + `,?[ \t]+\d{4}\b)`,
+	`(?P<version>\bv\d+(?:\.\d+)+(?:[-+][0-9A-Za-z.]+)?\b|\b\d+\.\d+\.\d+(?:[-+][0-9A-Za-z.]+)?\b)`,
+	`(?P<currency>[$€£¥₩][ \t]?` + numberExpr + scaleExpr + `|\b` + numberExpr + scaleExpr + `[ \t]?(?:USD|EUR|GBP|JPY|KRW|CNY|dollars?|euros?|pounds?|yen|won)\b)`,
+	`(?P<number>\b` + numberExpr + scaleExpr + `)`,
+}, "|"))
+
+var (
+	numberPattern = regexp.MustCompile(numberExpr)
+	digitRuns     = regexp.MustCompile(`\d+`)
+	scaleWord     = regexp.MustCompile(`\b(?:thousand|million|billion|trillion)\b`)
+	properNoun    = regexp.MustCompile(`\b(?:[A-Z][A-Za-z0-9]*[A-Z0-9][A-Za-z0-9]*|[a-z]+[A-Z][A-Za-z0-9]*|[A-Z][a-z]+)\b`)
+)
+
+var entityGroups = map[string]EntityKind{
+	"url":      EntityURL,
+	"email":    EntityEmail,
+	"version":  EntityVersion,
+	"date":     EntityDate,
+	"currency": EntityCurrency,
+	"number":   EntityNumber,
+}
+
+// findEntities returns the entities of the given kinds in s, in order of appearance.
+func findEntities(s string, kinds EntityKind) []entity {
+	var entities []entity
+	names := entityPattern.SubexpNames()
+	for _, m := range entityPattern.FindAllStringSubmatchIndex(s, -1) {
+		for i := 1; i < len(names); i++ {
+			if m[2*i] < 0 {
+				continue
+			}
+			kind := entityGroups[names[i]]
+			text := s[m[2*i]:m[2*i+1]]
+			if kind == EntityVersion && text[0] != 'v' && ungroup(text, ".") != text {
+				kind = EntityNumber // 1.000.000 is a number with grouped digits
+			}
+			if (kind == EntityNumber && len(text) == 1) || ((kind == EntityNumber || kind == EntityCurrency) && scaleWord.MatchString(text)) {
+				break
+			}
+			if kinds&kind != 0 {
+				entities = append(entities, entity{kind: kind, text: text})
+			}
+			break
+		}
+	}
+	if kinds&EntityProperNoun != 0 {
+		entities = append(entities, properNouns(entityPattern.ReplaceAllString(s, " "))...)
+	}
+	return entities
+}
+
+// properNouns returns the acronyms, mixed-case words and capitalized words of s that do not
+// start a sentence. Capitalized words of title-cased lines such as headings are skipped.
+func properNouns(s string) []entity {
+	var entities []entity
+	for _, line := range strings.Split(s, "\n") {
+		words := strings.Fields(line)
+		capitalized := 0
+		for _, w := range words {
+			if r := []rune(w); unicode.IsUpper(r[0]) {
+				capitalized++
+			}
+		}
+		titleCase := len(words) > 1 && capitalized*2 >= len(words)
+
+		for _, m := range properNoun.FindAllStringIndex(line, -1) {
+			word := line[m[0]:m[1]]
+			plain := len(word) > 1 && strings.ToUpper(word[:1]) == word[:1] && strings.ToLower(word[1:]) == word[1:]
+			if plain && (titleCase || startsSentence(line[:m[0]])) {
+				continue
+			}
+			entities = append(entities, entity{kind: EntityProperNoun, text: word})
+		}
+	}
+	return entities
+}
+
+// startsSentence reports whether a word preceded by before starts a sentence.
+func startsSentence(before string) bool {
+	before = strings.TrimRight(before, " \t\"'“‘(")
+	if before == "" {
+		return true
+	}
+	switch before[len(before)-1] {
+	case '.', '!', '?', ':', '#', '>', '-', '*', '+', '|':
+		return true
+	}
+	return false
+}
+
+// numberSet returns the numbers of s, both as written and as every run of digits, normalized.
+func numberSet(s string) map[string]bool {
+	numbers := make(map[string]bool)
+	for _, n := range numberPattern.FindAllString(s, -1) {
+		numbers[normalizeNumber(n)] = true
+	}
+	for _, n := range digitRuns.FindAllString(s, -1) {
+		numbers[normalizeNumber(n)] = true
+	}
+	return numbers
+}
+
+// normalizeNumber removes the digit grouping of n and writes its decimal separator as ".",
+// so that "1,000.50", "1.000,5" and "1000.5" are all "1000.5".
+func normalizeNumber(n string) string {
+	lastDot, lastComma := strings.LastIndex(n, "."), strings.LastIndex(n, ",")
+	switch {
+	case lastDot >= 0 && lastComma >= 0:
+		decimal := max(lastDot, lastComma)
+		n = strings.NewReplacer(".", "", ",", "").Replace(n[:decimal]) + "." + n[decimal+1:]
+	case lastComma >= 0:
+		n = ungroup(n, ",")
+	case lastDot >= 0:
+		n = ungroup(n, ".")
+	}
+
+	integer, fraction, ok := strings.Cut(n, ".")
+	integer = strings.TrimLeft(integer, "0")
+	if integer == "" {
+		integer = "0"
+	}
+	fraction = strings.TrimRight(fraction, "0")
+	if !ok || fraction == "" {
+		return integer
+	}
+	return integer + "." + fraction
+}
+
+// ungroup treats sep as digit grouping if every group after the first has three digits
+// and as the decimal separator otherwise.
+func ungroup(n, sep string) string {
+	groups := strings.Split(n, sep)
+	grouped := true
+	for _, g := range groups[1:] {
+		grouped = grouped && len(g) == 3
+	}
+	if grouped {
+		return strings.Join(groups, "")
+	}
+	if len(groups) == 2 {
+		return groups[0] + "." + groups[1]
+	}
+	return n
+}
@@ -0,0 +1,147 @@
+package translate
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lemon-mint/coord/llm"
+	"gosuda.org/deeplingua/internal/mask"
+)
+
+// ErrorKind classifies why a chunk could not be translated.
+type ErrorKind int
+
+const (
+	ErrorUnknown       ErrorKind = iota // any other provider or transport error
+	ErrorMarkerMissing                  // the response does not contain the start and end tokens
+	ErrorTruncated                      // the response was cut off before the end token
+	ErrorRateLimited                    // the provider rejected the request because of quota or load
+	ErrorRefused                        // the provider refused to answer, e.g. because of a safety filter
+	ErrorCanceled                       // the context was canceled or its deadline exceeded
+	ErrorTokenMismatch                  // masked tokens were lost or duplicated
+	ErrorValidation                     // the translation failed validation
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorMarkerMissing:
+		return "marker_missing"
+	case ErrorTruncated:
+		return "truncated"
+	case ErrorRateLimited:
+		return "rate_limited"
+	case ErrorRefused:
+		return "refused"
+	case ErrorCanceled:
+		return "canceled"
+	case ErrorTokenMismatch:
+		return "token_mismatch"
+	case ErrorValidation:
+		return "validation"
+	default:
+		return "unknown"
+	}
+}
+
+// ChunkError is returned when a chunk could not be translated.
+// Use errors.As to inspect it.
+type ChunkError struct {
+	Kind         ErrorKind
+	Chunk        int              // index of the chunk within the document
+	Provider     string           // name of the model that handled the request
+	FinishReason llm.FinishReason // finish reason reported by the provider, if any
+	RetryAfter   time.Duration    // wait requested by the provider, if any
+	Err          error            // underlying error, if any
+}
+
+func (e *ChunkError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("deeplingua: chunk ")
+	sb.WriteString(strconv.Itoa(e.Chunk))
+	sb.WriteString(": ")
+	sb.WriteString(e.Kind.String())
+	if e.Provider != "" {
+		sb.WriteString(" (provider: ")
+		sb.WriteString(e.Provider)
+		sb.WriteString(")")
+	}
+	if e.Err != nil {
+		sb.WriteString(": ")
+		sb.WriteString(e.Err.Error())
+	}
+	return sb.String()
+}
+
+func (e *ChunkError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports ErrFailedToTranslate for malformed responses, so existing checks keep working.
+func (e *ChunkError) Is(target error) bool {
+	return target == ErrFailedToTranslate && (e.Kind == ErrorMarkerMissing || e.Kind == ErrorTruncated)
+}
+
+// RetryAfterError may be implemented by errors of custom models to pass a retry-after hint.
+type RetryAfterError interface {
+	error
+	RetryAfter() time.Duration
+}
+
+var retryAfterRegexps = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)retry (?:in|after) ([0-9]+(?:\.[0-9]+)?) ?(ms|s|sec|secs|seconds?)?\b`),
+	regexp.MustCompile(`"?retryDelay"?:\s*"([0-9]+(?:\.[0-9]+)?)(s)"`),
+}
+
+// retryAfter extracts the wait requested by the provider from err.
+func retryAfter(err error) time.Duration {
+	var rae RetryAfterError
+	if errors.As(err, &rae) {
+		return rae.RetryAfter()
+	}
+
+	msg := err.Error()
+	for _, re := range retryAfterRegexps {
+		m := re.FindStringSubmatch(msg)
+		if m == nil {
+			continue
+		}
+		v, err := strconv.ParseFloat(m[1], 64)
+		if err != nil {
+			continue
+		}
+		if m[2] == "ms" {
+			return time.Duration(v * float64(time.Millisecond))
+		}
+		return time.Duration(v * float64(time.Second))
+	}
+	return 0
+}
+
+// classifyError determines the ErrorKind of an error returned by a provider.
+func classifyError(err error) ErrorKind {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return ErrorCanceled
+	case errors.Is(err, llm.ErrRateLimit), errors.Is(err, llm.ErrOverloaded):
+		return ErrorRateLimited
+	case errors.Is(err, mask.ErrTokenMismatch):
+		return ErrorTokenMismatch
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "ResourceExhausted"),
+		strings.Contains(msg, "Quota exceeded"),
+		strings.Contains(msg, "RESOURCE_EXHAUSTED"),
+		strings.Contains(msg, "status code: 429"),
+		strings.Contains(msg, "Error 429"),
+		strings.Contains(strings.ToLower(msg), "rate limit"):
+		return ErrorRateLimited
+	}
+
+	return ErrorUnknown
+}
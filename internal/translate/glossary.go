@@ -0,0 +1,133 @@
+package translate
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Glossary lists terms that must be translated in a fixed way.
+type Glossary struct {
+	Terms          map[string]string `json:"terms,omitempty"`            // source term -> required target term
+	DoNotTranslate []string          `json:"do_not_translate,omitempty"` // terms kept exactly as written
+}
+
+// LoadGlossary reads a JSON encoded Glossary from path.
+func LoadGlossary(path string) (*Glossary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var g Glossary
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+// match returns the glossary entries occurring in source, sorted by source term.
+func (g *Glossary) match(source string) (terms []string, dnt []string) {
+	if g == nil {
+		return nil, nil
+	}
+
+	for term := range g.Terms {
+		if containsTerm(source, term) {
+			terms = append(terms, term)
+		}
+	}
+	slices.Sort(terms)
+
+	for _, term := range g.DoNotTranslate {
+		if containsTerm(source, term) {
+			dnt = append(dnt, term)
+		}
+	}
+	slices.Sort(dnt)
+
+	return terms, dnt
+}
+
+// promptSection returns the glossary instructions for the terms occurring in source.
+func (g *Glossary) promptSection(source string) string {
+	terms, dnt := g.match(source)
+	if len(terms) == 0 && len(dnt) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	if len(terms) > 0 {
+		sb.WriteString("GLOSSARY (you MUST translate these terms exactly as listed):\n")
+		for _, term := range terms {
+			sb.WriteString("- " + strconv.Quote(term) + " -> " + strconv.Quote(g.Terms[term]) + "\n")
+		}
+	}
+	if len(dnt) > 0 {
+		sb.WriteString("DO NOT TRANSLATE (keep these terms exactly as written):\n")
+		for _, term := range dnt {
+			sb.WriteString("- " + strconv.Quote(term) + "\n")
+		}
+	}
+	return sb.String()
+}
+
+// Validate reports glossary terms of source whose required translation is missing in translated.
+func (g *Glossary) Validate(source, translated string) []Violation {
+	terms, dnt := g.match(source)
+
+	var violations []Violation
+	for _, term := range terms {
+		if !strings.Contains(translated, g.Terms[term]) {
+			violations = append(violations, Violation{
+				Rule:    "glossary",
+				Message: strconv.Quote(term) + " must be translated as " + strconv.Quote(g.Terms[term]),
+			})
+		}
+	}
+	for _, term := range dnt {
+		if !strings.Contains(translated, term) {
+			violations = append(violations, Violation{
+				Rule:    "glossary",
+				Message: strconv.Quote(term) + " must not be translated",
+			})
+		}
+	}
+	return violations
+}
+
+// containsTerm reports whether term occurs in s as a whole word.
+func containsTerm(s, term string) bool {
+	if term == "" {
+		return false
+	}
+
+	for offset := 0; ; {
+		idx := strings.Index(s[offset:], term)
+		if idx == -1 {
+			return false
+		}
+		start := offset + idx
+		end := start + len(term)
+
+		before, _ := utf8.DecodeLastRuneInString(s[:start])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			return true
+		}
+		offset = start + 1
+	}
+}
+
+// isWordRune reports whether r continues a word. Scripts written without spaces
+// never do, so that "Gemini는" still contains the term "Gemini".
+func isWordRune(r rune) bool {
+	if r == utf8.RuneError || unicode.In(r, unicode.Hangul, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Thai) {
+		return false
+	}
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
@@ -0,0 +1,215 @@
+package translate
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// MarkdownValidator checks that a translated chunk keeps the markdown structure of its source:
+// heading levels, list items, code blocks and their content, table shapes, link targets
+// and the layout of blank lines.
+type MarkdownValidator struct{}
+
+func (MarkdownValidator) Validate(source, translated string) []Violation {
+	want, got := parseMarkdown(source), parseMarkdown(translated)
+
+	var violations []Violation
+	violate := func(format string, args ...any) {
+		violations = append(violations, Violation{Rule: "markdown", Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !slices.Equal(want.headings, got.headings) {
+		violate("heading levels %v became %v", want.headings, got.headings)
+	}
+	if want.listItems != got.listItems {
+		violate("%d list items became %d", want.listItems, got.listItems)
+	}
+	if len(want.fences) != len(got.fences) {
+		violate("%d code blocks became %d", len(want.fences), len(got.fences))
+	} else {
+		for i := range want.fences {
+			if want.fences[i] != got.fences[i] {
+				violate("content of code block %d changed", i+1)
+			}
+		}
+	}
+	if len(want.tables) != len(got.tables) {
+		violate("%d tables became %d", len(want.tables), len(got.tables))
+	} else {
+		for i := range want.tables {
+			if want.tables[i] != got.tables[i] {
+				violate("table %d of %d rows and %d columns became %d rows and %d columns",
+					i+1, want.tables[i].rows, want.tables[i].columns, got.tables[i].rows, got.tables[i].columns)
+			}
+		}
+	}
+	for _, link := range missing(want.links, got.links) {
+		violate("link target %s is missing", strconv.Quote(link))
+	}
+	if !slices.Equal(want.blankLines, got.blankLines) || want.trailingNewlines != got.trailingNewlines {
+		violate("blank-line layout changed")
+	}
+	return violations
+}
+
+// markdownStructure is the part of a markdown text a translation must not change.
+type markdownStructure struct {
+	headings         []int    // level of every heading, in order
+	listItems        int      // number of list items
+	fences           []string // content of every fenced code block, in order
+	tables           []tableShape
+	links            []string // targets of links, images and link reference definitions
+	blankLines       []int    // length of every run of blank lines between lines of text
+	trailingNewlines int
+}
+
+type tableShape struct {
+	rows    int // including the header row
+	columns int
+}
+
+var (
+	atxHeading     = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]|$)`)
+	setextHeading  = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	thematicBreak  = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	listItem       = regexp.MustCompile(`^[ \t]*(?:[-*+]|\d{1,9}[.)])[ \t]+\S`)
+	tableDelimiter = regexp.MustCompile(`^[ \t]*\|?[ \t]*:?-+:?[ \t]*(?:\|[ \t]*:?-+:?[ \t]*)*\|?[ \t]*$`)
+	linkTarget     = regexp.MustCompile(`\]\(\s*<?([^\s)>]+)`)
+	autolink       = regexp.MustCompile(`<((?:https?|mailto):[^\s>]+)>`)
+	linkDefinition = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:[ \t]*<?([^\s>]+)`)
+)
+
+func parseMarkdown(text string) markdownStructure {
+	var s markdownStructure
+	s.trailingNewlines = len(text) - len(strings.TrimRight(text, "\n"))
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+
+	var fence string // opening fence of the code block being read, "" outside code blocks
+	var code strings.Builder
+	blank := -1 // blank lines since the last line of text, -1 before the first one
+	paragraph := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimLeft(line, " \t")
+
+		if fence != "" {
+			if t := strings.TrimSpace(line); strings.HasPrefix(t, fence) && strings.Trim(t, fence[:1]) == "" {
+				s.fences = append(s.fences, code.String())
+				fence = ""
+				code.Reset()
+			} else {
+				code.WriteString(line + "\n")
+			}
+			continue
+		}
+
+		if strings.TrimSpace(line) == "" {
+			if blank >= 0 {
+				blank++
+			}
+			paragraph = false
+			continue
+		}
+		if blank > 0 {
+			s.blankLines = append(s.blankLines, blank)
+		}
+		blank = 0
+
+		if f := openingFence(trimmed); f != "" {
+			fence = f
+			paragraph = false
+			continue
+		}
+		if m := atxHeading.FindStringSubmatch(line); m != nil {
+			s.headings = append(s.headings, len(m[1]))
+			paragraph = false
+			continue
+		}
+		if m := setextHeading.FindStringSubmatch(line); m != nil && paragraph {
+			level := 1
+			if m[1][0] == '-' {
+				level = 2
+			}
+			s.headings = append(s.headings, level)
+			paragraph = false
+			continue
+		}
+		if strings.Contains(line, "|") && i+1 < len(lines) && strings.Contains(lines[i+1], "|") && tableDelimiter.MatchString(lines[i+1]) {
+			shape := tableShape{rows: 1, columns: len(splitRow(lines[i+1]))}
+			for i += 2; i < len(lines) && strings.Contains(lines[i], "|") && strings.TrimSpace(lines[i]) != ""; i++ {
+				s.links = appendLinks(s.links, lines[i])
+				shape.rows++
+			}
+			i--
+			s.links = appendLinks(s.links, line)
+			s.tables = append(s.tables, shape)
+			paragraph = false
+			continue
+		}
+		if thematicBreak.MatchString(line) {
+			paragraph = false
+			continue
+		}
+		if listItem.MatchString(line) {
+			s.listItems++
+		}
+		if m := linkDefinition.FindStringSubmatch(line); m != nil {
+			s.links = append(s.links, m[1])
+		}
+		s.links = appendLinks(s.links, line)
+		paragraph = true
+	}
+	if fence != "" {
+		// An unclosed code block runs to the end of the text.
+		s.fences = append(s.fences, code.String())
+	}
+	return s
+}
+
+// openingFence returns the fence a line opens a code block with, or "".
+func openingFence(line string) string {
+	for _, c := range []string{"`", "~"} {
+		n := len(line) - len(strings.TrimLeft(line, c))
+		if n >= 3 && (c == "~" || !strings.Contains(line[n:], "`")) {
+			return strings.Repeat(c, n)
+		}
+	}
+	return ""
+}
+
+func splitRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	row = strings.TrimSuffix(row, "|")
+	return strings.Split(row, "|")
+}
+
+func appendLinks(links []string, line string) []string {
+	for _, m := range linkTarget.FindAllStringSubmatch(line, -1) {
+		links = append(links, m[1])
+	}
+	for _, m := range autolink.FindAllStringSubmatch(line, -1) {
+		links = append(links, m[1])
+	}
+	return links
+}
+
+// missing returns the elements of want that got lacks, counting repeated elements.
+func missing(want, got []string) []string {
+	counts := make(map[string]int, len(got))
+	for _, s := range got {
+		counts[s]++
+	}
+	var m []string
+	for _, s := range want {
+		if counts[s] > 0 {
+			counts[s]--
+			continue
+		}
+		m = append(m, s)
+	}
+	return m
+}
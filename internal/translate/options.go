@@ -0,0 +1,248 @@
+package translate
+
+import (
+	"github.com/lemon-mint/coord/llm"
+	"github.com/rs/zerolog"
+	"gosuda.org/deeplingua/internal/chunk"
+	"gosuda.org/deeplingua/internal/mask"
+	"gosuda.org/deeplingua/prompt"
+)
+
+// Chunker splits a document into chunks which are translated separately.
+// Joining the chunks must yield the original document.
+type Chunker func(input string) []string
+
+// DefaultChunker splits markdown documents into chunks of at most chunk.DefaultMaxTokens tokens.
+var DefaultChunker Chunker = chunk.ChunkMarkdown
+
+// Option configures a Translator.
+type Option func(*Translator)
+
+// WithPrompt replaces the prompt template. The templates are executed with PromptData,
+// and the text to translate is appended to their output.
+func WithPrompt(p *prompt.Set) Option {
+	return func(t *Translator) {
+		if p != nil {
+			t.prompt = p
+		}
+	}
+}
+
+// WithCustomPrompt sets additional instructions, passed to the prompt as PromptData.Instructions.
+func WithCustomPrompt(customPrompt string) Option {
+	return func(t *Translator) {
+		t.customPrompt = customPrompt
+	}
+}
+
+// WithChunker replaces the function used to split documents into chunks.
+func WithChunker(c Chunker) Option {
+	return func(t *Translator) {
+		t.chunker = c
+	}
+}
+
+// WithChunkTokens uses the markdown chunker with a token budget of maxTokens per chunk.
+func WithChunkTokens(maxTokens int) Option {
+	return func(t *Translator) {
+		t.chunker = func(input string) []string {
+			return chunk.ChunkMarkdownTokens(input, maxTokens)
+		}
+	}
+}
+
+// WithReasoning sets how reasoning in <think> blocks and requests marked as Reasoning is translated.
+// The default is ReasoningTranslate. Under ReasoningSeparate, reasoning is split by c, or by the
+// chunker of the Translator if c is nil, and translated with the reasoning prompt.
+func WithReasoning(p ReasoningPolicy, c Chunker) Option {
+	return func(t *Translator) {
+		t.reasoning = p
+		t.reasoningChunker = c
+	}
+}
+
+// WithReasoningPrompt replaces the prompt template used for reasoning under ReasoningSeparate.
+func WithReasoningPrompt(p *prompt.Set) Option {
+	return func(t *Translator) {
+		if p != nil {
+			t.reasoningPrompt = p
+		}
+	}
+}
+
+// WithRetryPolicy sets the retry policy for chunk translations.
+func WithRetryPolicy(p RetryPolicy) Option {
+	return func(t *Translator) {
+		t.retry = p
+	}
+}
+
+// WithSourceLanguage sets the language of the input documents.
+func WithSourceLanguage(lang string) Option {
+	return func(t *Translator) {
+		if lang != "" {
+			t.sourceLanguage = lang
+		}
+	}
+}
+
+// WithTargetLanguage sets the language to translate into.
+func WithTargetLanguage(lang string) Option {
+	return func(t *Translator) {
+		t.targetLanguage = lang
+	}
+}
+
+// WithDomain sets the subject area of the documents, e.g. "medicine" or "software".
+func WithDomain(domain string) Option {
+	return func(t *Translator) {
+		t.domain = domain
+	}
+}
+
+// WithSkipTargetLanguage returns documents that detect reports to be in the target language
+// unchanged instead of translating them.
+func WithSkipTargetLanguage(detect LanguageDetector) Option {
+	return func(t *Translator) {
+		t.detector = detect
+	}
+}
+
+// WithRegister sets the register the translation should prioritize. It is either the name of
+// a register profile, e.g. "polite", or a description such as "formal register".
+func WithRegister(register string) Option {
+	return func(t *Translator) {
+		if register != "" {
+			t.register = register
+		}
+	}
+}
+
+// WithRegisterProfiles adds the register profiles of p, replacing built-in profiles of the same
+// language and name.
+func WithRegisterProfiles(p Profiles) Option {
+	return func(t *Translator) {
+		t.profiles = t.profiles.With(p)
+	}
+}
+
+// WithConcurrency sets how many chunks of a single document are translated at the same time.
+// The default is 1, which translates the chunks one after another.
+func WithConcurrency(n int) Option {
+	return func(t *Translator) {
+		if n > 0 {
+			t.concurrency = n
+		}
+	}
+}
+
+// WithContextWindow makes every chunk request carry up to n preceding source chunks and their
+// accepted translations as read-only context, keeping terminology consistent across chunks.
+// Chunks are then translated one after another and WithConcurrency has no effect.
+// The default is 0, which translates every chunk independently.
+func WithContextWindow(n int) Option {
+	return func(t *Translator) {
+		t.contextWindow = max(0, n)
+	}
+}
+
+// WithGlossary adds the entries of g occurring in each chunk to the prompt
+// and validates the translated chunks against them.
+func WithGlossary(g *Glossary) Option {
+	return func(t *Translator) {
+		if g == nil {
+			return
+		}
+		t.glossary = g
+		t.validators = append(t.validators, g)
+	}
+}
+
+// WithValidator adds a validator run on every translated chunk.
+func WithValidator(v Validator) Option {
+	return func(t *Translator) {
+		t.validators = append(t.validators, v)
+	}
+}
+
+// WithValidationPolicy sets what happens to chunks that fail validation. The default is ValidationRetry.
+func WithValidationPolicy(p ValidationPolicy) Option {
+	return func(t *Translator) {
+		t.validation = p
+	}
+}
+
+// WithMasking replaces the given kinds of spans with opaque tokens before a chunk is sent to the model
+// and restores them afterwards. A translation that loses or duplicates a token fails and is retried.
+func WithMasking(kinds mask.Kind) Option {
+	return func(t *Translator) {
+		t.masking = kinds
+	}
+}
+
+// WithSplitDepth sets how many times a chunk whose translation was truncated is split in half
+// before giving up. The default is DefaultSplitDepth; 0 retries truncated chunks unchanged.
+func WithSplitDepth(n int) Option {
+	return func(t *Translator) {
+		t.splitDepth = max(0, n)
+	}
+}
+
+// WithCache makes the Translator look up chunks in c before calling the model
+// and store the translations that pass validation. Translations are kept apart for every model
+// unless WithSharedCache is given. Retranslations with the judge's feedback are not cached.
+func WithCache(c Cache) Option {
+	return func(t *Translator) {
+		t.cache = c
+	}
+}
+
+// WithSharedCache sets whether cached translations are shared by all models,
+// so that a chunk translated by one model is reused for the others.
+func WithSharedCache(shared bool) Option {
+	return func(t *Translator) {
+		t.sharedCache = shared
+	}
+}
+
+// WithRefinement makes the Translator score every translated document with e and, while the score
+// is below threshold, translate it again with the judge's reasoning, at most iterations times.
+// TranslateStream does not refine.
+func WithRefinement(e Evaluator, threshold float64, iterations int) Option {
+	return func(t *Translator) {
+		t.evaluator = e
+		t.refineThreshold = threshold
+		t.refineIterations = iterations
+	}
+}
+
+// WithCandidates makes the Translator translate every chunk n times and keep the candidate
+// scored highest by s (ViolationScorer if nil). The candidates are requested from models in turn,
+// e.g. the same model with a higher temperature or different models, or from the model of
+// the Translator if models is empty. With keep set, Result.Selections records every candidate.
+func WithCandidates(n int, s Scorer, keep bool, models ...llm.Model) Option {
+	return func(t *Translator) {
+		t.candidates = n
+		t.scorer = s
+		if t.scorer == nil {
+			t.scorer = ViolationScorer{}
+		}
+		t.keepCandidates = keep
+		t.candidateModels = models
+	}
+}
+
+// WithUsageRecorder sets r to be told about the token usage of every model request,
+// e.g. a *UsageCounter shared by several Translators to total the usage of a run.
+func WithUsageRecorder(r UsageRecorder) Option {
+	return func(t *Translator) {
+		t.usage = r
+	}
+}
+
+// WithLogger sets the logger used to report retries.
+func WithLogger(logger zerolog.Logger) Option {
+	return func(t *Translator) {
+		t.logger = logger
+	}
+}
@@ -0,0 +1,70 @@
+package translate
+
+import (
+	"strings"
+
+	"gosuda.org/deeplingua/internal/chunk"
+	"gosuda.org/deeplingua/prompt"
+)
+
+// DefaultReasoningPrompt is the built-in prompt for reasoning translated under ReasoningSeparate.
+// It is executed with PromptData.
+var DefaultReasoningPrompt = prompt.MustLoad(prompts, "prompts/reasoning")
+
+// ReasoningPolicy decides how the reasoning of a model is translated: the content of
+// <think> blocks and requests that are reasoning as a whole. Think tags are always kept unchanged.
+type ReasoningPolicy int
+
+const (
+	// ReasoningTranslate translates reasoning like the rest of the text.
+	ReasoningTranslate ReasoningPolicy = iota
+	// ReasoningKeep leaves reasoning untouched.
+	ReasoningKeep
+	// ReasoningSeparate translates reasoning in chunks of its own with the reasoning prompt.
+	ReasoningSeparate
+)
+
+// chunkKind is how a chunk of a document is translated.
+type chunkKind int
+
+const (
+	chunkText      chunkKind = iota
+	chunkReasoning           // translated with the reasoning prompt
+	chunkFixed               // copied unchanged, e.g. a think tag
+)
+
+// split splits text into chunks. Think tags and blank text between them are kept as they are,
+// and reasoning is chunked according to the reasoning policy. With reasoning set,
+// the whole text is reasoning.
+func (t *Translator) split(text string, reasoning bool) ([]string, []chunkKind) {
+	blocks := chunk.SplitThink(text)
+	if reasoning {
+		blocks = []chunk.Block{{Text: text, Kind: chunk.BlockReasoning}}
+	}
+
+	var chunks []string
+	var kinds []chunkKind
+	add := func(cs []string, kind chunkKind) {
+		for _, c := range cs {
+			chunks = append(chunks, c)
+			kinds = append(kinds, kind)
+		}
+	}
+	for _, b := range blocks {
+		switch {
+		case b.Kind == chunk.BlockTag, strings.TrimSpace(b.Text) == "":
+			add([]string{b.Text}, chunkFixed)
+		case b.Kind == chunk.BlockReasoning && t.reasoning == ReasoningKeep:
+			add([]string{b.Text}, chunkFixed)
+		case b.Kind == chunk.BlockReasoning && t.reasoning == ReasoningSeparate:
+			chunker := t.reasoningChunker
+			if chunker == nil {
+				chunker = t.chunker
+			}
+			add(chunker(b.Text), chunkReasoning)
+		default:
+			add(t.chunker(b.Text), chunkText)
+		}
+	}
+	return chunks, kinds
+}
@@ -0,0 +1,77 @@
+package translate
+
+import (
+	"context"
+
+	"gosuda.org/deeplingua/internal/judge"
+)
+
+// Evaluator scores the translation of a document. *judge.Evaluator is an Evaluator.
+// On failure, Evaluate may return the Evaluation together with the error to report the tokens used.
+type Evaluator interface {
+	Evaluate(ctx context.Context, sourceLanguage, targetLanguage, source, translation string) (*judge.Evaluation, error)
+}
+
+// Refinement is a judged translation of a document.
+type Refinement struct {
+	Text   string  `json:"text"`
+	Score  float64 `json:"score"`
+	Reason string  `json:"reason,omitempty"`
+}
+
+// refine judges result and, while the score is below the threshold and the iteration budget lasts,
+// translates the document again with the reason given by the judge. The best scored translation
+// is returned with every attempt recorded in Refinements. If the judge fails, refinement stops.
+// The judge sees only the translated chunks, without think tags and reasoning kept as it is.
+func (t *Translator) refine(ctx context.Context, params *Request, doc *document, result *Result) (*Result, error) {
+	source := doc.translatable(doc.chunks)
+	if t.evaluator == nil || source == "" {
+		return result, nil
+	}
+
+	var best *Result
+	var attempts []Refinement
+	usage := make(ModelUsage)
+	for i := 0; ; i++ {
+		usage.Merge(result.Usage)
+		evaluation, err := t.evaluator.Evaluate(ctx, params.SourceLanguage, params.TargetLanguage, source, result.translatable)
+		if err != nil {
+			// The judge may have answered without a readable score, which used tokens too.
+			if evaluation != nil {
+				usage.Merge(t.recordUsage(evaluation.Model, usageOf(evaluation.Usage)))
+			}
+			t.logger.Error().Err(err).Int("iteration", i).Msg("failed to judge translation, stopping refinement")
+			if best == nil {
+				best = result
+			}
+			break
+		}
+
+		usage.Merge(t.recordUsage(evaluation.Model, usageOf(evaluation.Usage)))
+		result.Score = evaluation.Score
+		attempts = append(attempts, Refinement{Text: result.Text, Score: evaluation.Score, Reason: evaluation.Reason})
+		if best == nil || result.Score > best.Score {
+			best = result
+		}
+		if result.Score >= t.refineThreshold || i >= t.refineIterations {
+			break
+		}
+
+		t.logger.Info().Float64("score", result.Score).Int("iteration", i+1).Msg("translation scored below threshold, refining")
+		p := *params
+		p.Feedback = evaluation.Reason
+		result, err = t.translateDocument(ctx, &p, doc)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, withUsage(err, usage)
+			}
+			usage.Merge(UsageOf(err))
+			t.logger.Error().Err(err).Int("iteration", i+1).Msg("failed to refine translation")
+			break
+		}
+	}
+
+	best.Refinements = attempts
+	best.Usage = usage
+	return best, nil
+}
@@ -0,0 +1,74 @@
+package translate
+
+import (
+	_ "embed"
+	"encoding/json"
+	"os"
+
+	"gosuda.org/deeplingua/langid"
+)
+
+// Profile describes a register of a target language.
+type Profile struct {
+	Description string   `json:"description"`        // put into the prompt, e.g. "polite register (해요체)"
+	Examples    []string `json:"examples,omitempty"` // sentences written in the register
+}
+
+// Profiles maps ISO 639-1 language codes to the register profiles of the language by name,
+// e.g. "formal", "polite", "casual" or "plain". The profiles under "*" apply to every language
+// that has no profile of that name.
+type Profiles map[string]map[string]Profile
+
+//go:embed registers.json
+var defaultProfiles []byte
+
+// DefaultProfiles are the built-in formal, polite, casual and plain profiles, and the original
+// profile that keeps the tone of the source.
+var DefaultProfiles = mustParseProfiles(defaultProfiles)
+
+func mustParseProfiles(data []byte) Profiles {
+	var p Profiles
+	if err := json.Unmarshal(data, &p); err != nil {
+		panic(err)
+	}
+	return p
+}
+
+// LoadProfiles reads JSON encoded Profiles from path.
+func LoadProfiles(path string) (Profiles, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Profiles
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Lookup returns the profile called name for the target language lang.
+func (p Profiles) Lookup(lang, name string) (Profile, bool) {
+	if profile, ok := p[langid.Code(lang)][name]; ok {
+		return profile, true
+	}
+	profile, ok := p["*"][name]
+	return profile, ok
+}
+
+// With returns the profiles of p overridden by those of o.
+func (p Profiles) With(o Profiles) Profiles {
+	merged := make(Profiles, len(p)+len(o))
+	for _, ps := range []Profiles{p, o} {
+		for lang, profiles := range ps {
+			if merged[lang] == nil {
+				merged[lang] = make(map[string]Profile, len(profiles))
+			}
+			for name, profile := range profiles {
+				merged[lang][name] = profile
+			}
+		}
+	}
+	return merged
+}
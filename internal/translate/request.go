@@ -0,0 +1,61 @@
+package translate
+
+import "gosuda.org/deeplingua/langid"
+
+// Request is a single document to translate. Empty fields fall back to the options of the Translator.
+type Request struct {
+	Text           string
+	SourceLanguage string
+	TargetLanguage string
+	Domain         string // subject area of the text, e.g. "medicine" or "software"
+	Register       string
+	Instructions   string // additional instructions, appended to the custom prompt
+	Feedback       string // review of a previous translation, e.g. the reason given by a judge
+	Reasoning      bool   // the whole text is the reasoning of a model, e.g. a reasoning field of a message
+
+	Role    string // role of the text within a conversation, e.g. "user" or "assistant"
+	History []Turn // earlier turns of the conversation, passed as read-only context
+}
+
+// Turn is an earlier message of the conversation a Request belongs to.
+type Turn struct {
+	Role         string
+	Text         string
+	Translations map[string]string // accepted translation by target language
+}
+
+// resolve fills the empty fields of req with the defaults of t.
+func (t *Translator) resolve(req *Request) *Request {
+	r := *req
+	if r.SourceLanguage == "" {
+		r.SourceLanguage = t.sourceLanguage
+	}
+	if r.TargetLanguage == "" {
+		r.TargetLanguage = t.targetLanguage
+	}
+	if r.Domain == "" {
+		r.Domain = t.domain
+	}
+	if r.Register == "" {
+		r.Register = t.register
+	}
+	if r.Instructions != "" && t.customPrompt != "" {
+		r.Instructions = t.customPrompt + "\n" + r.Instructions
+	} else if r.Instructions == "" {
+		r.Instructions = t.customPrompt
+	}
+	return &r
+}
+
+// LanguageDetector returns the ISO 639-1 code of the language of text, or "" if it is unknown.
+// langid.Language is a LanguageDetector.
+type LanguageDetector func(text string) string
+
+// alreadyInTarget reports whether text is detected to be in the target language of req.
+func (t *Translator) alreadyInTarget(req *Request) bool {
+	if t.detector == nil {
+		return false
+	}
+	detected := t.detector(req.Text)
+	return detected != "" && detected == langid.Code(req.TargetLanguage)
+}
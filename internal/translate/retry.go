@@ -0,0 +1,109 @@
+package translate
+
+import (
+	"context"
+	"math"
+	mrand "math/rand/v2"
+	"time"
+)
+
+// Attempt describes a failed attempt to translate a chunk.
+type Attempt struct {
+	Kind       ErrorKind     // class of the latest failure
+	Err        error         // latest failure
+	Count      int           // failures of this class so far, including the latest one
+	Total      int           // failures of any class so far, including the latest one
+	Elapsed    time.Duration // time since the first attempt started
+	RetryAfter time.Duration // wait requested by the provider, if any
+}
+
+// RetryPolicy decides whether and when a failed chunk is retried.
+// Implementations must be safe for concurrent use.
+type RetryPolicy interface {
+	// Backoff returns the wait before the next attempt, or false to give up.
+	Backoff(a Attempt) (time.Duration, bool)
+}
+
+// ExponentialBackoff retries with exponentially growing, jittered delays
+// within a budget of attempts per error class and a maximum total time.
+type ExponentialBackoff struct {
+	BaseDelay  time.Duration // delay after the first failure
+	MaxDelay   time.Duration // upper bound of a single delay
+	Multiplier float64       // growth factor per failure, 2 if zero
+	Jitter     float64       // fraction of the delay randomized, between 0 and 1
+	MaxElapsed time.Duration // no retry starts after this much time, unlimited if zero
+
+	MaxAttempts       int               // failures allowed for classes missing from Budgets
+	Budgets           map[ErrorKind]int // failures allowed per error class
+	HonorRetryAfter   bool              // wait at least as long as the provider asks
+	MinRateLimitDelay time.Duration     // lower bound of the delay after a rate limit error
+}
+
+var DefaultRetryPolicy RetryPolicy = &ExponentialBackoff{
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    time.Minute,
+	Multiplier:  2,
+	Jitter:      0.5,
+	MaxElapsed:  15 * time.Minute,
+	MaxAttempts: 6,
+	Budgets: map[ErrorKind]int{
+		ErrorRateLimited: 30,
+		ErrorRefused:     2,
+		ErrorCanceled:    0,
+	},
+	HonorRetryAfter:   true,
+	MinRateLimitDelay: 5 * time.Second,
+}
+
+func (b *ExponentialBackoff) Backoff(a Attempt) (time.Duration, bool) {
+	budget, ok := b.Budgets[a.Kind]
+	if !ok {
+		budget = b.MaxAttempts
+	}
+	if a.Count >= budget {
+		return 0, false
+	}
+
+	multiplier := b.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	delay := float64(b.BaseDelay) * math.Pow(multiplier, float64(a.Count-1))
+	if b.MaxDelay > 0 {
+		delay = min(delay, float64(b.MaxDelay))
+	}
+	if b.Jitter > 0 {
+		delay = delay*(1-b.Jitter) + delay*b.Jitter*mrand.Float64()
+	}
+
+	d := time.Duration(delay)
+	if a.Kind == ErrorRateLimited {
+		d = max(d, b.MinRateLimitDelay)
+	}
+	if b.HonorRetryAfter {
+		d = max(d, a.RetryAfter)
+	}
+
+	if b.MaxElapsed > 0 && a.Elapsed+d > b.MaxElapsed {
+		return 0, false
+	}
+	return d, true
+}
+
+// sleep waits for d or until ctx is done, whichever comes first.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package translate
+
+import (
+	"context"
+	"iter"
+	"time"
+)
+
+// TranslatedChunk is a translated part of a document yielded by TranslateStream.
+type TranslatedChunk struct {
+	Index       int           // position of the chunk within the document
+	Total       int           // number of chunks in the document
+	Source      string        // source text of the chunk
+	Translation string        // translated text of the chunk
+	Violations  []Violation   // validation violations of the accepted translation
+	Usage       ModelUsage    // tokens used for the chunk, including failed attempts
+	Started     time.Time     // when the translation of the chunk started
+	Elapsed     time.Duration // time spent translating the chunk, including retries
+}
+
+// TranslateStream translates input and yields every chunk as soon as it and all chunks before it
+// are translated, so joining the translations in the order received yields the translated document.
+// Translation stops at the first error, which is yielded last. Breaking out of the loop cancels the
+// chunks still in flight.
+func (t *Translator) TranslateStream(ctx context.Context, input string) iter.Seq2[TranslatedChunk, error] {
+	return t.TranslateStreamRequest(ctx, &Request{Text: input})
+}
+
+// TranslateStreamRequest is like TranslateStream but uses the languages and instructions of req.
+// A text already in the target language is yielded unchanged as a single chunk.
+func (t *Translator) TranslateStreamRequest(ctx context.Context, req *Request) iter.Seq2[TranslatedChunk, error] {
+	return func(yield func(TranslatedChunk, error) bool) {
+		params := t.resolve(req)
+		if t.alreadyInTarget(params) {
+			yield(TranslatedChunk{Total: 1, Source: req.Text, Translation: req.Text, Started: time.Now()}, nil)
+			return
+		}
+
+		doc := t.prepare(params)
+		chunks := doc.chunks
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type completion struct {
+			index  int
+			result chunkResult
+		}
+		completions := make(chan completion, len(chunks))
+		errc := make(chan error, 1)
+		go func() {
+			errc <- t.runChunks(ctx, params, doc, func(i int, r chunkResult) {
+				completions <- completion{index: i, result: r}
+			})
+			close(completions)
+		}()
+		// Wait for the translation goroutines, even if the caller stops early.
+		defer func() {
+			cancel()
+			for range completions {
+			}
+		}()
+
+		pending := make(map[int]chunkResult)
+		next := 0
+		for c := range completions {
+			pending[c.index] = c.result
+			for {
+				r, ok := pending[next]
+				if !ok {
+					break
+				}
+				delete(pending, next)
+
+				if !yield(TranslatedChunk{
+					Index:       next,
+					Total:       len(chunks),
+					Source:      chunks[next],
+					Translation: r.text,
+					Violations:  r.violations,
+					Usage:       r.usage,
+					Started:     r.started,
+					Elapsed:     r.elapsed,
+				}, nil) {
+					return
+				}
+				next++
+			}
+		}
+
+		if err := <-errc; err != nil {
+			yield(TranslatedChunk{}, err)
+		}
+	}
+}
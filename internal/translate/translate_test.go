@@ -0,0 +1,1143 @@
+package translate_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lemon-mint/coord/llm"
+	"gosuda.org/deeplingua/internal/judge"
+	"gosuda.org/deeplingua/internal/mask"
+	"gosuda.org/deeplingua/internal/translate"
+	"gosuda.org/deeplingua/langid"
+	"gosuda.org/deeplingua/prompt"
+)
+
+// echoModel answers every request by repeating the marked input with "paragraph" translated.
+type echoModel struct {
+	calls atomic.Int64
+}
+
+func (m *echoModel) GenerateStream(ctx context.Context, chat *llm.ChatContext, input *llm.Content) *llm.StreamContent {
+	m.calls.Add(1)
+	prompt := string(input.Parts[0].(llm.Text))
+	text := prompt[strings.LastIndex(prompt, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+	return response(strings.ReplaceAll(text, "paragraph", "문단"))
+}
+
+func (m *echoModel) Close() error { return nil }
+func (m *echoModel) Name() string { return "echo" }
+
+func response(text string) *llm.StreamContent {
+	stream := make(chan llm.Segment)
+	close(stream)
+	return &llm.StreamContent{
+		Content:      llm.TextContent(llm.RoleModel, text),
+		FinishReason: llm.FinishReasonStop,
+		Stream:       stream,
+	}
+}
+
+// fastRetry retries without waiting.
+var fastRetry = translate.WithRetryPolicy(&translate.ExponentialBackoff{MaxAttempts: 6})
+
+func paragraphChunker(input string) []string {
+	return strings.SplitAfter(input, "\n\n")
+}
+
+func TestTranslatorTranslate(t *testing.T) {
+	m := &echoModel{}
+	tr := translate.New(m, fastRetry,
+		translate.WithTargetLanguage("Korean"),
+		translate.WithChunker(paragraphChunker),
+	)
+
+	input := "first paragraph\n\nsecond paragraph\n\nthird"
+	got, err := tr.Translate(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "first 문단\n\nsecond 문단\n\nthird"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if m.calls.Load() != 3 {
+		t.Errorf("expected 3 model calls, got %d", m.calls.Load())
+	}
+}
+
+func TestTranslatorPrompt(t *testing.T) {
+	var prompt string
+	m := modelFunc(func(p string) *llm.StreamContent {
+		prompt = p
+		return response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+	})
+	tr := translate.New(m, fastRetry,
+		translate.WithSourceLanguage("English"),
+		translate.WithTargetLanguage("Japanese"),
+		translate.WithRegister("plain written style"),
+		translate.WithCustomPrompt("CUSTOM INSTRUCTIONS"),
+		translate.WithChunker(paragraphChunker),
+	)
+	if _, err := tr.Translate(context.Background(), "hello"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"from English into Japanese", "prioritizing plain written style", "CUSTOM INSTRUCTIONS"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q", want)
+		}
+	}
+}
+
+func TestTranslatorRegisterProfile(t *testing.T) {
+	var got string
+	m := modelFunc(func(p string) *llm.StreamContent {
+		got = p
+		return response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+	})
+	tr := translate.New(m, fastRetry,
+		translate.WithTargetLanguage("Korean"),
+		translate.WithRegister("polite"),
+		translate.WithRegisterProfiles(translate.Profiles{"*": {"polite": {Description: "POLITE"}}}),
+		translate.WithChunker(paragraphChunker),
+	)
+
+	result, err := tr.TranslateDocument(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"prioritizing polite register (해요체)", "  - 50%가 증가했어요.\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("prompt does not contain %q:\n%s", want, got)
+		}
+	}
+	if result.Register != "polite" {
+		t.Errorf("Register = %q, want polite", result.Register)
+	}
+
+	// Languages without a polite profile of their own fall back to "*".
+	if _, err := tr.TranslateRequest(context.Background(), &translate.Request{Text: "hello", TargetLanguage: "Vietnamese"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "prioritizing POLITE.") || strings.Contains(got, "Examples of sentences") {
+		t.Errorf("prompt does not use the fallback profile:\n%s", got)
+	}
+}
+
+func TestTranslatorConversation(t *testing.T) {
+	var got string
+	m := modelFunc(func(p string) *llm.StreamContent {
+		got = p
+		return response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+	})
+	tr := translate.New(m, fastRetry, translate.WithChunker(paragraphChunker))
+
+	_, err := tr.TranslateRequest(context.Background(), &translate.Request{
+		Text:           "Sure, here it is.",
+		TargetLanguage: "Korean",
+		Role:           "assistant",
+		History: []translate.Turn{
+			{Role: "user", Text: "Can you send me the file?", Translations: map[string]string{"Korean": "파일 좀 보내 줄래?"}},
+			{Role: "assistant", Text: "Which file?", Translations: map[string]string{"Japanese": "どのファイルですか？"}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"The text is a turn of the assistant in a conversation.",
+		"<turn role=\"user\">\n<source>\nCan you send me the file?\n</source>\n<translation>\n파일 좀 보내 줄래?\n</translation>\n</turn>\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("prompt does not contain %q:\n%s", want, got)
+		}
+	}
+	// Turns without a translation into the target language are left out.
+	if strings.Contains(got, "Which file?") || strings.Contains(got, "Consider each text segment as independent") {
+		t.Errorf("unexpected history in prompt:\n%s", got)
+	}
+}
+
+func TestTranslatorReasoning(t *testing.T) {
+	var prompts []string
+	m := modelFunc(func(p string) *llm.StreamContent {
+		prompts = append(prompts, p)
+		text := p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+		return response(strings.ReplaceAll(text, "think", "생각"))
+	})
+	const input = "<think>\nI think it is 4.\n</think>\n\nI think the answer is 4."
+
+	tests := []struct {
+		name      string
+		policy    translate.ReasoningPolicy
+		want      string
+		reasoning int // requests with the reasoning prompt
+	}{
+		{"translate", translate.ReasoningTranslate, "<think>\nI 생각 it is 4.\n</think>\n\nI 생각 the answer is 4.", 0},
+		{"keep", translate.ReasoningKeep, "<think>\nI think it is 4.\n</think>\n\nI 생각 the answer is 4.", 0},
+		{"separate", translate.ReasoningSeparate, "<think>\nI 생각 it is 4.\n</think>\n\nI 생각 the answer is 4.", 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prompts = nil
+			tr := translate.New(m, fastRetry, translate.WithTargetLanguage("Korean"), translate.WithChunker(paragraphChunker), translate.WithReasoning(tt.policy, nil))
+			got, err := tr.Translate(context.Background(), input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			reasoning := 0
+			for _, p := range prompts {
+				if strings.Contains(p, "<think>") || strings.Contains(p, "</think>") {
+					t.Errorf("think tag sent to the model:\n%s", p)
+				}
+				if strings.Contains(p, "reasoning trace") {
+					reasoning++
+				}
+			}
+			if reasoning != tt.reasoning {
+				t.Errorf("%d requests used the reasoning prompt, want %d", reasoning, tt.reasoning)
+			}
+		})
+	}
+
+	// A request marked as reasoning is reasoning as a whole.
+	prompts = nil
+	tr := translate.New(m, fastRetry, translate.WithTargetLanguage("Korean"), translate.WithReasoning(translate.ReasoningSeparate, paragraphChunker))
+	result, err := tr.TranslateRequest(context.Background(), &translate.Request{Text: "First, think.\n\nThen think again.", Reasoning: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text != "First, 생각.\n\nThen 생각 again." || len(prompts) != 2 || !strings.Contains(prompts[0], "reasoning trace") {
+		t.Errorf("got %q from %d requests", result.Text, len(prompts))
+	}
+}
+
+func TestTranslatorPromptTemplate(t *testing.T) {
+	var got string
+	m := modelFunc(func(p string) *llm.StreamContent {
+		got = p
+		return response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+	})
+	set := &prompt.Set{
+		Default:  mustParse(t, "translate", "{{/* version: 2 */ -}}\nDEFAULT {{.TargetLanguage}}\nINPUT_TEXT:\n\n"),
+		Variants: map[string]*prompt.Template{"func": mustParse(t, "translate.func", "{{/* version: 2 */ -}}\nVARIANT {{.TargetLanguage}}\nINPUT_TEXT:\n\n")},
+	}
+	tr := translate.New(m, fastRetry, translate.WithPrompt(set), translate.WithTargetLanguage("Korean"), translate.WithChunker(paragraphChunker))
+
+	result, err := tr.TranslateDocument(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(got, "VARIANT Korean\n") {
+		t.Errorf("prompt of the model variant was not used:\n%s", got)
+	}
+	if len(result.Prompts) != 1 || result.Prompts[0] != set.Variants["func"].ID() {
+		t.Errorf("Prompts = %v, want [%s]", result.Prompts, set.Variants["func"].ID())
+	}
+}
+
+func mustParse(t *testing.T, name, text string) *prompt.Template {
+	t.Helper()
+	tmpl, err := prompt.Parse(name, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tmpl
+}
+
+func TestTranslatorConcurrency(t *testing.T) {
+	var inflight, peak atomic.Int64
+	m := modelFunc(func(p string) *llm.StreamContent {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+	})
+	tr := translate.New(m, fastRetry,
+		translate.WithChunker(paragraphChunker),
+		translate.WithConcurrency(4),
+	)
+
+	input := strings.Repeat("some paragraph\n\n", 16) + "end"
+	got, err := tr.Translate(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != input {
+		t.Errorf("chunks were not reassembled in order")
+	}
+	if peak.Load() < 2 || peak.Load() > 4 {
+		t.Errorf("expected between 2 and 4 concurrent requests, got %d", peak.Load())
+	}
+}
+
+func TestTranslatorConcurrencyCancel(t *testing.T) {
+	var calls atomic.Int64
+	m := modelFunc(func(p string) *llm.StreamContent {
+		calls.Add(1)
+		if strings.Contains(p, "bad") {
+			return response("no markers")
+		}
+		time.Sleep(10 * time.Millisecond)
+		return response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+	})
+	tr := translate.New(m, fastRetry,
+		translate.WithChunker(paragraphChunker),
+		translate.WithConcurrency(2),
+	)
+
+	input := "bad\n\n" + strings.Repeat("good\n\n", 64)
+	_, err := tr.Translate(context.Background(), input)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if calls.Load() >= 64 {
+		t.Errorf("sibling chunks were not cancelled, %d calls made", calls.Load())
+	}
+}
+
+func TestTranslatorContextWindow(t *testing.T) {
+	var prompts []string
+	m := modelFunc(func(p string) *llm.StreamContent {
+		prompts = append(prompts, p)
+		text := p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+		return response(strings.ReplaceAll(text, "paragraph", "문단"))
+	})
+	tr := translate.New(m, fastRetry,
+		translate.WithChunker(paragraphChunker),
+		translate.WithContextWindow(1),
+	)
+
+	got, err := tr.Translate(context.Background(), "one paragraph\n\ntwo paragraph\n\nthree")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "one 문단\n\ntwo 문단\n\nthree" {
+		t.Errorf("unexpected translation %q", got)
+	}
+
+	if strings.Contains(prompts[0], "PREVIOUS_CONTEXT (") {
+		t.Errorf("first chunk should not carry context")
+	}
+	if !strings.Contains(prompts[2], "<source>\ntwo paragraph\n\n\n</source>\n<translation>\ntwo 문단\n\n\n</translation>") {
+		t.Errorf("third chunk does not carry the preceding chunk:\n%s", prompts[2])
+	}
+	if strings.Contains(prompts[2], "one paragraph") {
+		t.Errorf("context window exceeded")
+	}
+}
+
+func TestTranslatorGlossary(t *testing.T) {
+	g := &translate.Glossary{
+		Terms:          map[string]string{"Gemini": "제미나이"},
+		DoNotTranslate: []string{"DeepLingua"},
+	}
+
+	var calls atomic.Int64
+	m := modelFunc(func(p string) *llm.StreamContent {
+		calls.Add(1)
+		if !strings.Contains(p, `"Gemini" -> "제미나이"`) || !strings.Contains(p, `- "DeepLingua"`) {
+			t.Errorf("glossary missing from prompt")
+		}
+		text := p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+		if calls.Load() < 3 {
+			text = strings.ReplaceAll(text, "Gemini", "재미나이")
+		} else {
+			text = strings.ReplaceAll(text, "Gemini", "제미나이")
+		}
+		return response(text)
+	})
+
+	tr := translate.New(m, fastRetry, translate.WithChunker(paragraphChunker), translate.WithGlossary(g))
+	result, err := tr.TranslateDocument(context.Background(), "DeepLingua uses Gemini.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text != "DeepLingua uses 제미나이." || len(result.Violations) != 0 {
+		t.Errorf("unexpected result %+v", result)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls.Load())
+	}
+
+	calls.Store(0)
+	tr = translate.New(m, fastRetry, translate.WithChunker(paragraphChunker), translate.WithGlossary(g), translate.WithValidationPolicy(translate.ValidationFlag))
+	result, err = tr.TranslateDocument(context.Background(), "DeepLingua uses Gemini.")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Violations) != 1 || result.Violations[0].Rule != "glossary" {
+		t.Errorf("expected one glossary violation, got %+v", result.Violations)
+	}
+}
+
+func TestTranslatorMasking(t *testing.T) {
+	var dropToken atomic.Bool
+	m := modelFunc(func(p string) *llm.StreamContent {
+		if strings.Contains(p, "https://example.com") {
+			t.Errorf("URL was sent to the model")
+		}
+		text := p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+		if dropToken.Load() {
+			text = strings.Replace(text, "⟦M1⟧", "", 1)
+		}
+		return response(strings.ReplaceAll(text, "Visit", "방문하세요"))
+	})
+
+	tr := translate.New(m, fastRetry, translate.WithChunker(paragraphChunker), translate.WithMasking(mask.All))
+	got, err := tr.Translate(context.Background(), "Visit https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "방문하세요 https://example.com" {
+		t.Errorf("unexpected translation %q", got)
+	}
+
+	dropToken.Store(true)
+	_, err = tr.Translate(context.Background(), "Visit https://example.com")
+	if !errors.Is(err, mask.ErrTokenMismatch) {
+		t.Errorf("expected ErrTokenMismatch, got %v", err)
+	}
+}
+
+func TestTranslatorErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		resp func() *llm.StreamContent
+		kind translate.ErrorKind
+	}{
+		{
+			name: "marker missing",
+			resp: func() *llm.StreamContent { return response("no markers") },
+			kind: translate.ErrorMarkerMissing,
+		},
+		{
+			name: "truncated",
+			resp: func() *llm.StreamContent {
+				r := response("cut off")
+				r.FinishReason = llm.FinishReasonMaxTokens
+				return r
+			},
+			kind: translate.ErrorTruncated,
+		},
+		{
+			name: "refused",
+			resp: func() *llm.StreamContent {
+				r := response("")
+				r.FinishReason = llm.FinishReasonSafety
+				return r
+			},
+			kind: translate.ErrorRefused,
+		},
+		{
+			name: "provider error",
+			resp: func() *llm.StreamContent {
+				r := response("")
+				r.Err = llm.ErrInternalServer
+				return r
+			},
+			kind: translate.ErrorUnknown,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := modelFunc(func(p string) *llm.StreamContent { return tc.resp() })
+			tr := translate.New(m, fastRetry, translate.WithChunker(paragraphChunker))
+
+			_, err := tr.Translate(context.Background(), "hello")
+			var chunkErr *translate.ChunkError
+			if !errors.As(err, &chunkErr) {
+				t.Fatalf("expected a ChunkError, got %v", err)
+			}
+			if chunkErr.Kind != tc.kind || chunkErr.Provider != "func" || chunkErr.Chunk != 0 {
+				t.Errorf("unexpected error %+v", chunkErr)
+			}
+		})
+	}
+}
+
+func TestTranslatorRetryCanceled(t *testing.T) {
+	m := modelFunc(func(p string) *llm.StreamContent {
+		r := response("")
+		r.Err = llm.ErrRateLimit
+		return r
+	})
+	tr := translate.New(pickerModel{m}, translate.WithChunker(paragraphChunker))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := tr.Translate(ctx, "hello")
+	if time.Since(start) > time.Second {
+		t.Errorf("retry did not stop on context cancellation")
+	}
+	var chunkErr *translate.ChunkError
+	if !errors.As(err, &chunkErr) || chunkErr.Kind != translate.ErrorCanceled {
+		t.Errorf("expected a canceled ChunkError, got %v", err)
+	}
+	// The error names the model that served the request, not the one that routed it.
+	if chunkErr != nil && chunkErr.Provider != "func" {
+		t.Errorf("got provider %q, want func", chunkErr.Provider)
+	}
+}
+
+// pickerModel routes every request to its model, like a load balancer.
+type pickerModel struct {
+	modelFunc
+}
+
+func (m pickerModel) Name() string    { return "balancer" }
+func (m pickerModel) Pick() llm.Model { return m.modelFunc }
+
+func TestExponentialBackoff(t *testing.T) {
+	b := &translate.ExponentialBackoff{
+		BaseDelay:   time.Second,
+		MaxDelay:    4 * time.Second,
+		MaxElapsed:  time.Minute,
+		MaxAttempts: 3,
+		Budgets: map[translate.ErrorKind]int{
+			translate.ErrorRateLimited: 10,
+		},
+		HonorRetryAfter: true,
+	}
+
+	for count, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second} {
+		d, ok := b.Backoff(translate.Attempt{Kind: translate.ErrorRateLimited, Count: count + 1})
+		if !ok || d != want {
+			t.Errorf("attempt %d: got %v %v, want %v", count+1, d, ok, want)
+		}
+	}
+
+	if _, ok := b.Backoff(translate.Attempt{Kind: translate.ErrorMarkerMissing, Count: 3}); ok {
+		t.Errorf("budget of the default class was not enforced")
+	}
+	if _, ok := b.Backoff(translate.Attempt{Kind: translate.ErrorRateLimited, Count: 1, Elapsed: 59500 * time.Millisecond}); ok {
+		t.Errorf("maximum total time was not enforced")
+	}
+	if d, _ := b.Backoff(translate.Attempt{Kind: translate.ErrorRateLimited, Count: 1, RetryAfter: 30 * time.Second}); d != 30*time.Second {
+		t.Errorf("retry-after hint was not honored, got %v", d)
+	}
+}
+
+func TestRetryAfterHint(t *testing.T) {
+	m := modelFunc(func(p string) *llm.StreamContent {
+		r := response("")
+		r.Err = errors.New("googleapi: Error 429: Resource exhausted. Please retry in 41.5s.")
+		return r
+	})
+	tr := translate.New(m, translate.WithChunker(paragraphChunker),
+		translate.WithRetryPolicy(&translate.ExponentialBackoff{}))
+
+	_, err := tr.Translate(context.Background(), "hello")
+	var chunkErr *translate.ChunkError
+	if !errors.As(err, &chunkErr) {
+		t.Fatalf("expected a ChunkError, got %v", err)
+	}
+	if chunkErr.Kind != translate.ErrorRateLimited || chunkErr.RetryAfter != 41500*time.Millisecond {
+		t.Errorf("unexpected error %+v", chunkErr)
+	}
+}
+
+func TestTranslateStream(t *testing.T) {
+	m := modelFunc(func(p string) *llm.StreamContent {
+		text := p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+		if strings.Contains(text, "slow") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		return response(strings.ReplaceAll(text, "paragraph", "문단"))
+	})
+	tr := translate.New(m, fastRetry, translate.WithChunker(paragraphChunker), translate.WithConcurrency(4))
+
+	var sb strings.Builder
+	var indices []int
+	for c, err := range tr.TranslateStream(context.Background(), "slow paragraph\n\nfast paragraph\n\nlast") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.Total != 3 || c.Elapsed <= 0 {
+			t.Errorf("unexpected chunk %+v", c)
+		}
+		indices = append(indices, c.Index)
+		sb.WriteString(c.Translation)
+	}
+	if sb.String() != "slow 문단\n\nfast 문단\n\nlast" {
+		t.Errorf("unexpected translation %q", sb.String())
+	}
+	if len(indices) != 3 || indices[0] != 0 || indices[1] != 1 || indices[2] != 2 {
+		t.Errorf("chunks were not yielded in order: %v", indices)
+	}
+
+	// Stopping early must not leak or block.
+	for range tr.TranslateStream(context.Background(), "a\n\nb\n\nc") {
+		break
+	}
+}
+
+func TestTranslatorTruncationSplit(t *testing.T) {
+	var inputs []string
+	m := modelFunc(func(p string) *llm.StreamContent {
+		text := p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+		inputs = append(inputs, text[18:len(text)-18])
+		// Pretend the output limit only fits two lines.
+		if strings.Count(text, "\n") > 2 {
+			r := response(text[:len(text)/2])
+			r.FinishReason = llm.FinishReasonMaxTokens
+			return r
+		}
+		return response(strings.ReplaceAll(text, "line", "줄"))
+	})
+	tr := translate.New(m, fastRetry, translate.WithChunker(func(s string) []string { return []string{s} }))
+
+	input := "line 1\nline 2\nline 3\nline 4\nline 5\nline 6\nline 7\nline 8\n"
+	result, err := tr.TranslateDocument(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text != strings.ReplaceAll(input, "line", "줄") {
+		t.Errorf("unexpected translation %q", result.Text)
+	}
+	if len(result.Segments) != 4 || result.Segments[1].Source != "line 3\nline 4\n" || result.Segments[1].Translation != "줄 3\n줄 4\n" {
+		t.Errorf("expected a segment per translated piece, got %+v", result.Segments)
+	}
+	if len(inputs) != 7 {
+		t.Errorf("expected 7 requests (1 + 2 + 4), got %d: %q", len(inputs), inputs)
+	}
+
+	tr = translate.New(m, fastRetry, translate.WithChunker(func(s string) []string { return []string{s} }), translate.WithSplitDepth(0))
+	_, err = tr.Translate(context.Background(), input)
+	var chunkErr *translate.ChunkError
+	if !errors.As(err, &chunkErr) || chunkErr.Kind != translate.ErrorTruncated {
+		t.Errorf("expected a truncated ChunkError, got %v", err)
+	}
+}
+
+func TestTranslateRequest(t *testing.T) {
+	var prompt string
+	m := modelFunc(func(p string) *llm.StreamContent {
+		prompt = p
+		return response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+	})
+	tr := translate.New(m, fastRetry,
+		translate.WithChunker(paragraphChunker),
+		translate.WithTargetLanguage("Japanese"),
+		translate.WithCustomPrompt("CUSTOM"),
+		translate.WithSkipTargetLanguage(langid.Language),
+	)
+
+	result, err := tr.TranslateRequest(context.Background(), &translate.Request{
+		Text:           "hello",
+		SourceLanguage: "English",
+		TargetLanguage: "Korean",
+		Domain:         "medicine",
+		Instructions:   "EXTRA",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Skipped {
+		t.Errorf("English text must not be skipped")
+	}
+	for _, want := range []string{"from English into Korean", "domain of medicine", "CUSTOM\nEXTRA"} {
+		if !strings.Contains(prompt, want) {
+			t.Errorf("prompt does not contain %q", want)
+		}
+	}
+
+	prompt = ""
+	result, err = tr.TranslateRequest(context.Background(), &translate.Request{Text: "이미 한국어로 작성된 문장입니다.", TargetLanguage: "ko-KR"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Skipped || result.Text != "이미 한국어로 작성된 문장입니다." || prompt != "" {
+		t.Errorf("Korean text should be skipped, got %+v", result)
+	}
+}
+
+func TestTranslateTargets(t *testing.T) {
+	m := modelFunc(func(p string) *llm.StreamContent {
+		lang := p[strings.LastIndex(p, "translate the following text into ")+len("translate the following text into "):]
+		lang = lang[:strings.Index(lang, ".")]
+		text := p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+		if lang == "Japanese" {
+			r := response("")
+			r.Err = errors.New("boom")
+			return r
+		}
+		return response(strings.ReplaceAll(text, "paragraph", lang))
+	})
+	var chunked atomic.Int64
+	tr := translate.New(m,
+		translate.WithRetryPolicy(&translate.ExponentialBackoff{MaxAttempts: 1}),
+		translate.WithChunker(func(input string) []string {
+			chunked.Add(1)
+			return paragraphChunker(input)
+		}),
+		translate.WithSkipTargetLanguage(func(string) string { return "en" }),
+	)
+
+	results, err := tr.TranslateTargets(context.Background(), &translate.Request{Text: "one paragraph\n\ntwo paragraph"}, []string{"Korean", "Vietnamese", "English", "Japanese"})
+	var chunkErr *translate.ChunkError
+	if !errors.As(err, &chunkErr) || !strings.Contains(err.Error(), "Japanese") {
+		t.Errorf("err = %v, want a chunk error for Japanese", err)
+	}
+	if chunked.Load() != 1 {
+		t.Errorf("document chunked %d times, want 1", chunked.Load())
+	}
+
+	want := map[string]string{
+		"Korean":     "one Korean\n\ntwo Korean",
+		"Vietnamese": "one Vietnamese\n\ntwo Vietnamese",
+		"English":    "one paragraph\n\ntwo paragraph",
+	}
+	if len(results) != len(want) {
+		t.Errorf("got %d results, want %d", len(results), len(want))
+	}
+	for lang, text := range want {
+		if results[lang] == nil || results[lang].Text != text {
+			t.Errorf("results[%s] = %+v, want %q", lang, results[lang], text)
+		}
+	}
+	if !results["English"].Skipped {
+		t.Errorf("English should be skipped")
+	}
+}
+
+func TestTranslatorSegments(t *testing.T) {
+	tr := translate.New(&echoModel{}, fastRetry, translate.WithChunker(func(s string) []string {
+		i := strings.Index(s, "third")
+		return []string{s[:i], s[i:]}
+	}))
+
+	input := "first paragraph\n\nsecond paragraph\n\nthird paragraph\n```\ncode\n\nblock\n```\n"
+	result, err := tr.TranslateDocument(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Segments) != 2 {
+		t.Fatalf("expected a segment per chunk, got %+v", result.Segments)
+	}
+
+	paragraphs := result.Paragraphs()
+	want := []string{"first paragraph\n\n", "second paragraph\n\n", "third paragraph\n```\ncode\n\nblock\n```\n"}
+	if len(paragraphs) != len(want) {
+		t.Fatalf("got %d paragraphs, want %d: %+v", len(paragraphs), len(want), paragraphs)
+	}
+	for i, seg := range paragraphs {
+		if seg.Source != want[i] || seg.Translation != strings.ReplaceAll(want[i], "paragraph", "문단") {
+			t.Errorf("paragraph %d = %+v", i, seg)
+		}
+		if input[seg.SourceStart:seg.SourceEnd] != seg.Source || result.Text[seg.TranslationStart:seg.TranslationEnd] != seg.Translation {
+			t.Errorf("paragraph %d has wrong offsets: %+v", i, seg)
+		}
+	}
+}
+
+type evaluatorFunc func(translation string) (*judge.Evaluation, error)
+
+func (f evaluatorFunc) Evaluate(ctx context.Context, sourceLanguage, targetLanguage, source, translation string) (*judge.Evaluation, error) {
+	return f(translation)
+}
+
+func TestTranslatorRefinement(t *testing.T) {
+	var prompts []string
+	m := modelFunc(func(p string) *llm.StreamContent {
+		prompts = append(prompts, p)
+		text := p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+		if strings.Contains(p, "Use the polite form.") {
+			return response(strings.ReplaceAll(text, "hello", "안녕하세요"))
+		}
+		return response(strings.ReplaceAll(text, "hello", "안녕"))
+	})
+	e := evaluatorFunc(func(translation string) (*judge.Evaluation, error) {
+		if strings.Contains(translation, "안녕하세요") {
+			return &judge.Evaluation{Score: 0.9}, nil
+		}
+		return &judge.Evaluation{Score: 0.4, Reason: "Use the polite form."}, nil
+	})
+	tr := translate.New(m, fastRetry, translate.WithChunker(paragraphChunker), translate.WithRefinement(e, 0.8, 3))
+
+	result, err := tr.TranslateDocument(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text != "안녕하세요" || result.Score != 0.9 {
+		t.Errorf("got %q scored %v, want the refined translation", result.Text, result.Score)
+	}
+	if len(result.Refinements) != 2 || result.Refinements[0].Text != "안녕" || result.Refinements[0].Reason != "Use the polite form." {
+		t.Errorf("unexpected refinements %+v", result.Refinements)
+	}
+	if len(prompts) != 2 || strings.Contains(prompts[0], "reviewer") {
+		t.Errorf("expected feedback only in the second of 2 prompts, got %d prompts", len(prompts))
+	}
+
+	// Without improvement the budget ends refinement and the best attempt is kept.
+	prompts = nil
+	tr = translate.New(m, fastRetry, translate.WithChunker(paragraphChunker), translate.WithRefinement(evaluatorFunc(func(string) (*judge.Evaluation, error) {
+		return &judge.Evaluation{Score: 0.1, Reason: "bad"}, nil
+	}), 0.8, 2))
+	result, err = tr.TranslateDocument(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompts) != 3 || len(result.Refinements) != 3 {
+		t.Errorf("expected 3 attempts, got %d prompts and %d refinements", len(prompts), len(result.Refinements))
+	}
+
+	// Reasoning kept in the source language is not shown to the judge.
+	var judged string
+	tr = translate.New(m, fastRetry, translate.WithChunker(paragraphChunker), translate.WithReasoning(translate.ReasoningKeep, nil), translate.WithRefinement(evaluatorFunc(func(translation string) (*judge.Evaluation, error) {
+		judged = translation
+		return &judge.Evaluation{Score: 0.9}, nil
+	}), 0.8, 2))
+	result, err = tr.TranslateDocument(context.Background(), "<think>\nhello there\n</think>\n\nhello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(result.Text, "<think>\nhello there\n</think>") || strings.TrimSpace(judged) != "안녕" {
+		t.Errorf("got %q with %q judged, want the kept reasoning left out of the judged text", result.Text, judged)
+	}
+
+	// The tokens of a judge that answered without a score are accounted for.
+	tr = translate.New(m, fastRetry, translate.WithChunker(paragraphChunker), translate.WithRefinement(evaluatorFunc(func(string) (*judge.Evaluation, error) {
+		return &judge.Evaluation{Model: "judge", Usage: &llm.UsageData{InputTokens: 50, OutputTokens: 5}}, judge.ErrFailedToEvaluateTranslation
+	}), 0.8, 2))
+	result, err = tr.TranslateDocument(context.Background(), "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (translate.Usage{Requests: 1, InputTokens: 50, OutputTokens: 5}); result.Text != "안녕" || result.Usage["judge"] != want {
+		t.Errorf("got %q with judge usage %+v, want the translation with %+v", result.Text, result.Usage["judge"], want)
+	}
+}
+
+type scorerFunc func(c *translate.Candidate) float64
+
+func (f scorerFunc) Score(ctx context.Context, params *translate.Request, source string, c *translate.Candidate) (float64, error) {
+	return f(c), nil
+}
+
+func TestTranslatorCandidates(t *testing.T) {
+	translateWith := func(word string) modelFunc {
+		return func(p string) *llm.StreamContent {
+			text := p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):]
+			return response(strings.ReplaceAll(text, "paragraph", word))
+		}
+	}
+	score := scorerFunc(func(c *translate.Candidate) float64 {
+		if strings.Contains(c.Text, "문단") {
+			return 1
+		}
+		return 0.5
+	})
+	tr := translate.New(translateWith("unused"), fastRetry,
+		translate.WithChunker(paragraphChunker),
+		translate.WithCandidates(3, score, true, translateWith("단락"), translateWith("문단")),
+	)
+
+	result, err := tr.TranslateDocument(context.Background(), "one paragraph\n\ntwo paragraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Text != "one 문단\n\ntwo 문단" {
+		t.Errorf("got %q, want the candidates scored highest", result.Text)
+	}
+	if len(result.Selections) != 2 {
+		t.Fatalf("expected a selection per chunk, got %d", len(result.Selections))
+	}
+	sel := result.Selections[1]
+	if sel.Chunk != 1 || sel.Source != "two paragraph" || len(sel.Candidates) != 3 || sel.Candidates[sel.Chosen].Text != "two 문단" || sel.Candidates[sel.Chosen].Score != 1 {
+		t.Errorf("unexpected selection %+v", sel)
+	}
+}
+
+func TestTranslatorCandidatesCache(t *testing.T) {
+	m := &echoModel{}
+	c := mapCache{}
+	tr := translate.New(m, fastRetry, translate.WithCache(c), translate.WithChunker(paragraphChunker),
+		translate.WithCandidates(3, translate.ViolationScorer{}, false),
+	)
+
+	first, err := tr.TranslateDocument(context.Background(), "one paragraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := m.calls.Load()
+	if calls != 3 || len(c) != 1 {
+		t.Fatalf("%d calls and %d cache entries for 3 candidates, want 3 and 1", calls, len(c))
+	}
+
+	// A re-run takes the chosen candidate from the cache instead of translating the candidates again.
+	second, err := tr.TranslateDocument(context.Background(), "one paragraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.calls.Load() != calls || second.Cached != 1 || second.Text != first.Text {
+		t.Errorf("got %q with %d cached chunks after %d more calls, want %q from the cache", second.Text, second.Cached, m.calls.Load()-calls, first.Text)
+	}
+}
+
+type mapCache map[string]string
+
+func (c mapCache) Get(key string) (string, bool) { v, ok := c[key]; return v, ok }
+func (c mapCache) Put(key, translation string) error {
+	c[key] = translation
+	return nil
+}
+
+func TestTranslatorCache(t *testing.T) {
+	m := &echoModel{}
+	c := mapCache{}
+	tr := translate.New(m, fastRetry, translate.WithCache(c), translate.WithChunker(paragraphChunker), translate.WithTargetLanguage("Korean"))
+
+	input := "same paragraph\n\nsame paragraph\n\nother paragraph"
+	first, err := tr.TranslateDocument(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	calls := m.calls.Load()
+	// The repeated paragraph is translated once.
+	if len(c) != 2 || first.Cached != 1 || calls != 2 {
+		t.Errorf("cache has %d entries and served %d chunks after %d calls, want 2, 1 and 2", len(c), first.Cached, calls)
+	}
+
+	second, err := tr.TranslateDocument(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.calls.Load() != calls {
+		t.Errorf("model called %d times for a cached document", m.calls.Load()-calls)
+	}
+	if second.Text != first.Text || second.Cached != 3 {
+		t.Errorf("got %q with %d cached chunks, want %q with 3", second.Text, second.Cached, first.Text)
+	}
+
+	// A different target language must not hit the cache.
+	if _, err := tr.TranslateRequest(context.Background(), &translate.Request{Text: input, TargetLanguage: "Japanese"}); err != nil {
+		t.Fatal(err)
+	}
+	if m.calls.Load() == calls {
+		t.Errorf("cache was used for another target language")
+	}
+}
+
+func TestTranslatorCacheKey(t *testing.T) {
+	m := &echoModel{}
+	c := mapCache{}
+	tr := translate.New(m, fastRetry, translate.WithCache(c), translate.WithChunker(paragraphChunker), translate.WithContextWindow(1))
+	if _, err := tr.TranslateDocument(context.Background(), "first paragraph\n\nshared paragraph"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The shared paragraph is cached even though it follows another paragraph.
+	result, err := tr.TranslateDocument(context.Background(), "other paragraph\n\nshared paragraph")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Cached != 1 {
+		t.Errorf("%d chunks cached with another preceding paragraph, want 1", result.Cached)
+	}
+
+	// Another model uses the cache only if it is shared.
+	echo := modelFunc(func(p string) *llm.StreamContent {
+		return response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+	})
+	for _, shared := range []bool{false, true} {
+		c := mapCache{}
+		var result *translate.Result
+		for _, m := range []llm.Model{m, echo} {
+			tr := translate.New(m, fastRetry, translate.WithCache(c), translate.WithSharedCache(shared), translate.WithChunker(paragraphChunker))
+			var err error
+			if result, err = tr.TranslateDocument(context.Background(), "shared paragraph"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if want := map[bool]int{false: 0, true: 1}[shared]; result.Cached != want {
+			t.Errorf("shared %v: %d chunks cached for another model, want %d", shared, result.Cached, want)
+		}
+	}
+}
+
+func TestTranslatorUsage(t *testing.T) {
+	var calls atomic.Int64
+	m := modelFunc(func(p string) *llm.StreamContent {
+		var r *llm.StreamContent
+		if calls.Add(1) == 1 {
+			r = response("no markers")
+		} else {
+			r = response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+		}
+		r.UsageData = &llm.UsageData{InputTokens: 100, OutputTokens: 20}
+		return r
+	})
+	counter := &translate.UsageCounter{}
+	tr := translate.New(m, fastRetry, translate.WithChunker(paragraphChunker), translate.WithUsageRecorder(counter))
+
+	result, err := tr.TranslateDocument(context.Background(), "first\n\nsecond")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The failed attempt counts too.
+	want := translate.Usage{Requests: 3, InputTokens: 300, OutputTokens: 60}
+	if got := result.Usage["func"]; got != want {
+		t.Errorf("result usage %+v, want %+v", got, want)
+	}
+	if got := counter.Usage().Total(); got != want {
+		t.Errorf("recorded usage %+v, want %+v", got, want)
+	}
+
+	prices := translate.Prices{"fu": {Input: 1}, "func": {Input: 2, Output: 10}}
+	if cost := prices.Cost(result.Usage); cost != (300*2+60*10)/1e6 {
+		t.Errorf("cost %v", cost)
+	}
+}
+
+func TestTranslateTargetsFailedUsage(t *testing.T) {
+	m := modelFunc(func(p string) *llm.StreamContent {
+		r := response(p[strings.LastIndex(p, "INPUT_TEXT:\n\n")+len("INPUT_TEXT:\n\n"):])
+		if strings.Contains(p, "into Japanese") {
+			r = response("no markers")
+		}
+		r.UsageData = &llm.UsageData{InputTokens: 100, OutputTokens: 20}
+		return r
+	})
+	tr := translate.New(m, translate.WithRetryPolicy(&translate.ExponentialBackoff{MaxAttempts: 2}), translate.WithChunker(paragraphChunker))
+
+	results, err := tr.TranslateTargets(context.Background(), &translate.Request{Text: "hello"}, []string{"Korean", "Japanese"})
+	if err == nil || results["Korean"] == nil {
+		t.Fatalf("got %v, %v", results, err)
+	}
+	// Both attempts of the failed language are accounted for on the error.
+	want := translate.Usage{Requests: 2, InputTokens: 200, OutputTokens: 40}
+	if got := translate.UsageOf(err)["func"]; got != want {
+		t.Errorf("failed usage %+v, want %+v", got, want)
+	}
+}
+
+func TestMarkdownValidator(t *testing.T) {
+	source := "# Title\n\nSee [the docs](https://example.com/docs).\n\n## Steps\n\n- first\n- second\n\n" +
+		"```go\nfmt.Println(\"hi\")\n```\n\n| a | b |\n|---|---|\n| 1 | 2 |\n\n"
+
+	testCases := []struct {
+		name       string
+		translated string
+		want       []string
+	}{
+		{
+			name:       "unchanged structure",
+			translated: "# 제목\n\n[문서](https://example.com/docs)를 참고하세요.\n\n## 단계\n\n- 첫째\n- 둘째\n\n```go\nfmt.Println(\"hi\")\n```\n\n| 가 | 나 |\n|---|---|\n| 1 | 2 |\n\n",
+		},
+		{
+			name:       "heading level",
+			translated: "# 제목\n\n[문서](https://example.com/docs)를 참고하세요.\n\n### 단계\n\n- 첫째\n- 둘째\n\n```go\nfmt.Println(\"hi\")\n```\n\n| 가 | 나 |\n|---|---|\n| 1 | 2 |\n\n",
+			want:       []string{"heading levels [1 2] became [1 3]"},
+		},
+		{
+			name:       "lists, code, tables and links",
+			translated: "# 제목\n\n문서를 참고하세요.\n\n## 단계\n\n- 첫째, 둘째\n\n```go\nfmt.Println(\"안녕\")\n```\n\n| 가 |\n|---|\n| 1 |\n\n",
+			want: []string{
+				"2 list items became 1",
+				"content of code block 1 changed",
+				"table 1 of 2 rows and 2 columns became 2 rows and 1 columns",
+				`link target "https://example.com/docs" is missing`,
+			},
+		},
+		{
+			name:       "blank lines",
+			translated: "# 제목\n[문서](https://example.com/docs)를 참고하세요.\n\n## 단계\n\n- 첫째\n- 둘째\n\n```go\nfmt.Println(\"hi\")\n```\n\n| 가 | 나 |\n|---|---|\n| 1 | 2 |\n",
+			want:       []string{"blank-line layout changed"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, v := range (translate.MarkdownValidator{}).Validate(source, tc.translated) {
+				if v.Rule != "markdown" {
+					t.Errorf("unexpected rule %q", v.Rule)
+				}
+				got = append(got, v.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("got violations %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEntityValidator(t *testing.T) {
+	source := "On 2024-03-05 the team behind DeepLingua shipped v1.2.3 to 1,500 users in Seoul for $30.\n" +
+		"Read https://example.com/notes or write to team@example.com. It took 3 days and 2.5 million tokens."
+
+	testCases := []struct {
+		name       string
+		kinds      translate.EntityKind
+		translated string
+		want       []string
+	}{
+		{
+			name: "reformatted",
+			translated: "2024년 3월 5일, DeepLingua 팀은 Seoul의 사용자 1.500명에게 30달러에 v1.2.3을 배포했다.\n" +
+				"https://example.com/notes를 읽거나 team@example.com으로 문의하라. 사흘과 250만 토큰이 걸렸다.",
+		},
+		{
+			name:  "missing entities",
+			kinds: translate.EntityAll,
+			translated: "2024년 3월 6일, 딥링구아 팀은 서울의 사용자 1,050명에게 30달러에 v1.2를 배포했다.\n" +
+				"https://example.com을 읽거나 team@example.com으로 문의하라.",
+			want: []string{
+				`date "2024-03-05" is missing`,
+				`version "v1.2.3" is missing`,
+				`number "1,500" is missing`,
+				`URL "https://example.com/notes" is missing`,
+				`proper noun "DeepLingua" is missing`,
+				`proper noun "Seoul" is missing`,
+			},
+		},
+		{
+			name: "transliterated proper nouns",
+			translated: "2024년 3월 5일, 딥링구아 팀은 서울의 사용자 1.500명에게 30달러에 v1.2.3을 배포했다.\n" +
+				"https://example.com/notes를 읽거나 team@example.com으로 문의하라. 사흘과 250만 토큰이 걸렸다.",
+		},
+		{
+			name:       "selected kinds",
+			kinds:      translate.EntityURL | translate.EntityEmail,
+			translated: "https://example.com/notes team@example.com",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var got []string
+			for _, v := range (translate.EntityValidator{Kinds: tc.kinds}).Validate(source, tc.translated) {
+				got = append(got, v.Message)
+			}
+			if strings.Join(got, "\n") != strings.Join(tc.want, "\n") {
+				t.Errorf("got violations %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+type modelFunc func(prompt string) *llm.StreamContent
+
+func (f modelFunc) GenerateStream(ctx context.Context, chat *llm.ChatContext, input *llm.Content) *llm.StreamContent {
+	return f(string(input.Parts[0].(llm.Text)))
+}
+
+func (f modelFunc) Close() error { return nil }
+func (f modelFunc) Name() string { return "func" }
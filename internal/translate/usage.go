@@ -0,0 +1,183 @@
+package translate
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/lemon-mint/coord/llm"
+)
+
+// Usage is the number of tokens used by model requests, as reported by the provider.
+// Providers that report no usage only increase Requests.
+type Usage struct {
+	Requests     int `json:"requests"`
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Add adds the tokens of o to u.
+func (u *Usage) Add(o Usage) {
+	u.Requests += o.Requests
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+}
+
+func usageOf(data *llm.UsageData) Usage {
+	u := Usage{Requests: 1}
+	if data != nil {
+		u.InputTokens = data.InputTokens
+		u.OutputTokens = data.OutputTokens
+	}
+	return u
+}
+
+// ModelUsage is the usage of every model, keyed by the model name.
+type ModelUsage map[string]Usage
+
+// Add adds u to the usage of model.
+func (m ModelUsage) Add(model string, u Usage) {
+	total := m[model]
+	total.Add(u)
+	m[model] = total
+}
+
+// Merge adds the usage of every model of o to m.
+func (m ModelUsage) Merge(o ModelUsage) {
+	for model, u := range o {
+		m.Add(model, u)
+	}
+}
+
+// Total returns the usage summed over the models.
+func (m ModelUsage) Total() Usage {
+	var total Usage
+	for _, u := range m {
+		total.Add(u)
+	}
+	return total
+}
+
+// merged returns the usage of both m and o without modifying either.
+func (m ModelUsage) merged(o ModelUsage) ModelUsage {
+	if len(m) == 0 {
+		return o
+	}
+	if len(o) == 0 {
+		return m
+	}
+	u := make(ModelUsage, len(m)+len(o))
+	u.Merge(m)
+	u.Merge(o)
+	return u
+}
+
+// UsageError is an error of a translation together with the tokens it used before it failed.
+type UsageError struct {
+	Err   error
+	Usage ModelUsage
+}
+
+func (e *UsageError) Error() string { return e.Err.Error() }
+func (e *UsageError) Unwrap() error { return e.Err }
+
+// withUsage attaches usage to err, adding it to the usage err already carries.
+func withUsage(err error, usage ModelUsage) error {
+	if e, ok := err.(*UsageError); ok {
+		return &UsageError{Err: e.Err, Usage: e.Usage.merged(usage)}
+	}
+	if len(usage) == 0 {
+		return err
+	}
+	return &UsageError{Err: err, Usage: usage}
+}
+
+// UsageOf returns the tokens used by the failed translations of err, summed over every
+// UsageError it wraps, e.g. over the failed languages of TranslateTargets.
+func UsageOf(err error) ModelUsage {
+	usage := make(ModelUsage)
+	var walk func(error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case *UsageError:
+			usage.Merge(e.Usage)
+		case interface{ Unwrap() []error }:
+			for _, err := range e.Unwrap() {
+				walk(err)
+			}
+		case interface{ Unwrap() error }:
+			walk(e.Unwrap())
+		}
+	}
+	walk(err)
+	return usage
+}
+
+// UsageRecorder is told about the usage of every model request, including the requests of
+// failed attempts that are not part of any Result.
+type UsageRecorder interface {
+	RecordUsage(model string, u Usage)
+}
+
+// UsageCounter is a UsageRecorder that sums the usage of every model. It is safe for concurrent use.
+type UsageCounter struct {
+	mu    sync.Mutex
+	usage ModelUsage
+}
+
+func (c *UsageCounter) RecordUsage(model string, u Usage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.usage == nil {
+		c.usage = make(ModelUsage)
+	}
+	c.usage.Add(model, u)
+}
+
+// Usage returns a copy of the usage recorded so far.
+func (c *UsageCounter) Usage() ModelUsage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	u := make(ModelUsage, len(c.usage))
+	u.Merge(c.usage)
+	return u
+}
+
+func (t *Translator) recordUsage(model string, u Usage) ModelUsage {
+	if t.usage != nil {
+		t.usage.RecordUsage(model, u)
+	}
+	return ModelUsage{model: u}
+}
+
+// Price is the price of a model in a currency of choice per million tokens.
+type Price struct {
+	Input  float64 `json:"input"`
+	Output float64 `json:"output"`
+}
+
+// Prices maps models to their price. A key matches every model whose name contains it,
+// and the longest matching key wins, so "gemini-2.0-flash" also prices "gemini-2.0-flash-001".
+type Prices map[string]Price
+
+// Price returns the price of model and whether there is one.
+func (p Prices) Price(model string) (Price, bool) {
+	var price Price
+	best := -1
+	for key, kp := range p {
+		if len(key) > best && strings.Contains(model, key) {
+			price, best = kp, len(key)
+		}
+	}
+	return price, best >= 0
+}
+
+// Cost returns the cost of u. Models without a price cost nothing.
+func (p Prices) Cost(u ModelUsage) float64 {
+	var cost float64
+	for model, mu := range u {
+		if price, ok := p.Price(model); ok {
+			cost += (float64(mu.InputTokens)*price.Input + float64(mu.OutputTokens)*price.Output) / 1e6
+		}
+	}
+	return cost
+}
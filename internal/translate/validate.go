@@ -0,0 +1,34 @@
+package translate
+
+// Violation describes a rule a translated chunk does not satisfy.
+type Violation struct {
+	Chunk   int    `json:"chunk"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Validator checks a translated chunk against its source.
+type Validator interface {
+	Validate(source, translated string) []Violation
+}
+
+// ValidationPolicy decides what happens to chunks that fail validation.
+type ValidationPolicy int
+
+const (
+	// ValidationRetry retries the chunk and flags it if every attempt fails validation.
+	ValidationRetry ValidationPolicy = iota
+	// ValidationFlag accepts the translation and reports the violations.
+	ValidationFlag
+)
+
+func (t *Translator) validate(req chunkRequest, translated string) []Violation {
+	var violations []Violation
+	for _, v := range t.validators {
+		for _, violation := range v.Validate(req.text, translated) {
+			violation.Chunk = req.index
+			violations = append(violations, violation)
+		}
+	}
+	return violations
+}
@@ -0,0 +1,167 @@
+// Package langid identifies the language of a text offline, using script ratios
+// and character trigram profiles.
+package langid
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Result is the outcome of Detect.
+type Result struct {
+	Language   string  `json:"language,omitempty"` // ISO 639-1 code, "" if unknown
+	Confidence float64 `json:"confidence"`         // 0 to 1
+
+	// Mixed is set when a second language makes up a significant share of the text.
+	Mixed     bool   `json:"mixed,omitempty"`
+	Secondary string `json:"secondary,omitempty"`
+
+	// NoText is set when the text has no natural language, e.g. it is empty or pure code.
+	NoText bool `json:"no_text,omitempty"`
+}
+
+const (
+	// minLetters is the number of letters below which a text is considered to have no natural language.
+	minLetters = 3
+
+	// mixedShare is the share of letters from which a secondary language marks a text as mixed.
+	mixedShare = 0.2
+
+	// minConfidence is the confidence below which Language reports an unknown language.
+	minConfidence = 0.5
+)
+
+var (
+	fencedCode = regexp.MustCompile("(?s)(```|~~~).*?(```|~~~|$)")
+	inlineCode = regexp.MustCompile("`[^`\n]+`")
+	urls       = regexp.MustCompile(`(?:https?|ftp)://[^\s)>\]]+|\b[\w.+-]+@[\w-]+\.[\w.-]+\b`)
+	paragraphs = regexp.MustCompile(`\n\s*\n`)
+)
+
+// Detect identifies the language of text. Code blocks, inline code, URLs and e-mail addresses are ignored.
+func Detect(text string) Result {
+	stripped := fencedCode.ReplaceAllString(text, "\n\n")
+	stripped = inlineCode.ReplaceAllString(stripped, " ")
+	stripped = urls.ReplaceAllString(stripped, " ")
+
+	type vote struct {
+		weight     float64
+		confidence float64
+	}
+	votes := make(map[string]*vote)
+	var total float64
+	for _, p := range paragraphs.Split(stripped, -1) {
+		if looksLikeCode(p) {
+			continue
+		}
+		c, letters := countScripts(p)
+		if letters < minLetters {
+			continue
+		}
+
+		lang, confidence := languageOfScripts(c, letters, p)
+		if lang == "" && c[scriptLatin]*2 > letters {
+			lang, confidence = languageOfTrigrams(p)
+			if !hasWords(p, 3) {
+				confidence /= 2
+			}
+		}
+		if lang == "" {
+			continue
+		}
+
+		v := votes[lang]
+		if v == nil {
+			v = &vote{}
+			votes[lang] = v
+		}
+		v.weight += float64(letters)
+		v.confidence += float64(letters) * confidence
+		total += float64(letters)
+	}
+	if total == 0 {
+		return Result{NoText: true}
+	}
+
+	langs := make([]string, 0, len(votes))
+	for lang := range votes {
+		langs = append(langs, lang)
+	}
+	sort.Slice(langs, func(i, j int) bool {
+		if votes[langs[i]].weight != votes[langs[j]].weight {
+			return votes[langs[i]].weight > votes[langs[j]].weight
+		}
+		return langs[i] < langs[j]
+	})
+
+	primary := votes[langs[0]]
+	r := Result{
+		Language:   langs[0],
+		Confidence: primary.confidence / total,
+	}
+	if len(langs) > 1 && votes[langs[1]].weight/total >= mixedShare {
+		r.Mixed = true
+		r.Secondary = langs[1]
+	}
+	return r
+}
+
+// Reliable reports whether r identifies a single language with confidence.
+func (r Result) Reliable() bool {
+	return r.Language != "" && !r.NoText && !r.Mixed && r.Confidence >= minConfidence
+}
+
+// Language returns the ISO 639-1 code of the language of text, or "" if it has no natural language,
+// is mixed, or cannot be identified with confidence. It can be used as a translate.LanguageDetector.
+func Language(text string) string {
+	if r := Detect(text); r.Reliable() {
+		return r.Language
+	}
+	return ""
+}
+
+// looksLikeCode reports whether most lines of the paragraph p look like source code.
+func looksLikeCode(p string) bool {
+	var lines, code int
+	for _, line := range strings.Split(p, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		lines++
+		if isCodeLine(line) {
+			code++
+		}
+	}
+	return lines > 0 && code*10 >= lines*6
+}
+
+var codePrefixes = []string{
+	"#include", "import ", "from ", "package ", "func ", "def ", "class ", "return ",
+	"if (", "for (", "while (", "const ", "let ", "var ", "//", "/*", "#!",
+}
+
+func isCodeLine(line string) bool {
+	switch line[len(line)-1] {
+	case ';', '{', '}', '(', '[', ']':
+		return true
+	}
+	for _, prefix := range codePrefixes {
+		if strings.HasPrefix(line, prefix) && !strings.HasSuffix(line, ".") {
+			return true
+		}
+	}
+
+	// Lines dominated by symbols, e.g. "x = f(a, b) * 2"
+	var letters, symbols int
+	for _, r := range line {
+		switch {
+		case strings.ContainsRune("=(){}[]<>;:*/+-&|!$_\"'", r):
+			symbols++
+		case r > ' ':
+			letters++
+		}
+	}
+	return symbols*2 > letters
+}
@@ -0,0 +1,81 @@
+package langid_test
+
+import (
+	"testing"
+
+	"gosuda.org/deeplingua/langid"
+)
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"english", "Can you explain how the garbage collector decides when to run?", "en"},
+		{"german", "Kannst du mir erklären, wie der Speicher freigegeben wird und warum das wichtig ist?", "de"},
+		{"french", "Pouvez-vous m'expliquer comment fonctionne la mémoire et pourquoi elle est importante ?", "fr"},
+		{"spanish", "¿Puedes explicarme cómo funciona la memoria y por qué es tan importante para el programa?", "es"},
+		{"vietnamese", "Bạn có thể giải thích cách bộ nhớ hoạt động và tại sao nó quan trọng không?", "vi"},
+		{"korean", "가비지 컬렉터가 언제 실행되는지 설명해 주세요.", "ko"},
+		{"korean with terms", "Go의 `sync.Pool`은 GC cycle마다 비워지므로 캐시로 쓰기에는 적합하지 않아요.", "ko"},
+		{"japanese", "ガベージコレクタがいつ実行されるのか説明してください。", "ja"},
+		{"chinese", "请解释垃圾回收器什么时候运行。", "zh"},
+		{"russian", "Объясните, пожалуйста, когда запускается сборщик мусора.", "ru"},
+		{"ukrainian", "Поясніть, будь ласка, коли запускається збирач сміття.", "uk"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := langid.Detect(tt.text)
+			if r.Language != tt.want || r.NoText || r.Mixed {
+				t.Errorf("Detect(%q) = %+v, want %s", tt.text, r, tt.want)
+			}
+			if got := langid.Language(tt.text); got != tt.want {
+				t.Errorf("Language(%q) = %q, want %s (confidence %.2f)", tt.text, got, tt.want, r.Confidence)
+			}
+		})
+	}
+}
+
+func TestDetectNoText(t *testing.T) {
+	for _, text := range []string{
+		"",
+		"```go\nfunc main() {\n\tfmt.Println(\"hello\")\n}\n```",
+		"for (int i = 0; i < n; i++) {\n\tsum += a[i];\n}",
+		"https://example.com/docs/index.html",
+		"12 + 34 = 46",
+	} {
+		if r := langid.Detect(text); !r.NoText {
+			t.Errorf("Detect(%q) = %+v, want NoText", text, r)
+		}
+	}
+}
+
+func TestDetectMixed(t *testing.T) {
+	text := "다음 문단을 번역해 주세요. 원문의 형식은 그대로 유지해야 합니다.\n\n" +
+		"The quick brown fox jumps over the lazy dog, and then it runs away into the forest."
+	r := langid.Detect(text)
+	if !r.Mixed {
+		t.Fatalf("Detect() = %+v, want Mixed", r)
+	}
+	if langs := []string{r.Language, r.Secondary}; !(langs[0] == "en" && langs[1] == "ko" || langs[0] == "ko" && langs[1] == "en") {
+		t.Errorf("Detect() = %+v, want ko and en", r)
+	}
+	if got := langid.Language(text); got != "" {
+		t.Errorf("Language() = %q, want \"\" for mixed text", got)
+	}
+}
+
+func TestCode(t *testing.T) {
+	for lang, want := range map[string]string{
+		"Korean": "ko",
+		"ko":     "ko",
+		"ko-KR":  "ko",
+		"한국어":    "ko",
+		"zh_TW":  "zh",
+	} {
+		if got := langid.Code(lang); got != want {
+			t.Errorf("Code(%q) = %q, want %q", lang, got, want)
+		}
+	}
+}
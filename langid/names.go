@@ -0,0 +1,44 @@
+package langid
+
+import "strings"
+
+var languageCodes = map[string]string{
+	"arabic":     "ar",
+	"chinese":    "zh",
+	"dutch":      "nl",
+	"english":    "en",
+	"french":     "fr",
+	"german":     "de",
+	"greek":      "el",
+	"hebrew":     "he",
+	"hindi":      "hi",
+	"indonesian": "id",
+	"italian":    "it",
+	"japanese":   "ja",
+	"korean":     "ko",
+	"persian":    "fa",
+	"polish":     "pl",
+	"portuguese": "pt",
+	"russian":    "ru",
+	"spanish":    "es",
+	"thai":       "th",
+	"turkish":    "tr",
+	"ukrainian":  "uk",
+	"vietnamese": "vi",
+	"한국어":        "ko",
+	"日本語":        "ja",
+	"中文":         "zh",
+}
+
+// Code returns the ISO 639-1 code of a language given by its English name or a language tag,
+// e.g. "Korean", "ko" or "ko-KR".
+func Code(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if code, ok := languageCodes[lang]; ok {
+		return code
+	}
+	if i := strings.IndexAny(lang, "-_"); i != -1 {
+		lang = lang[:i]
+	}
+	return lang
+}
@@ -0,0 +1,155 @@
+package langid
+
+import (
+	"math"
+	"strings"
+	"unicode"
+)
+
+// samples are short texts from which the trigram profiles of languages written in the Latin script are built.
+var samples = map[string]string{
+	"en": `All human beings are born free and equal in dignity and rights. They are endowed with reason and conscience and should act towards one another in a spirit of brotherhood.
+The weather was nice today, so we decided to walk to the park and have lunch there. What do you think about this idea? I would like to know how it works and why it is important.
+Please write a function that returns the sum of all numbers in the list. This is the first step of the process, and it should be done before the next one starts.
+There are many reasons why people learn a new language, but the most common one is that they want to travel and talk with other people.`,
+	"de": `Alle Menschen sind frei und gleich an Würde und Rechten geboren. Sie sind mit Vernunft und Gewissen begabt und sollen einander im Geist der Brüderlichkeit begegnen.
+Das Wetter war heute schön, deshalb haben wir beschlossen, in den Park zu gehen und dort zu Mittag zu essen. Was hältst du von dieser Idee? Ich möchte wissen, wie es funktioniert und warum es wichtig ist.
+Bitte schreibe eine Funktion, die die Summe aller Zahlen in der Liste zurückgibt. Das ist der erste Schritt des Prozesses, und er sollte erledigt sein, bevor der nächste beginnt.
+Es gibt viele Gründe, warum Menschen eine neue Sprache lernen, aber der häufigste ist, dass sie reisen und mit anderen Menschen sprechen wollen.`,
+	"fr": `Tous les êtres humains naissent libres et égaux en dignité et en droits. Ils sont doués de raison et de conscience et doivent agir les uns envers les autres dans un esprit de fraternité.
+Il faisait beau aujourd'hui, alors nous avons décidé de marcher jusqu'au parc et d'y déjeuner. Que penses-tu de cette idée ? Je voudrais savoir comment cela fonctionne et pourquoi c'est important.
+Veuillez écrire une fonction qui renvoie la somme de tous les nombres de la liste. C'est la première étape du processus, et elle doit être terminée avant que la suivante ne commence.
+Il y a beaucoup de raisons pour lesquelles les gens apprennent une nouvelle langue, mais la plus courante est qu'ils veulent voyager et parler avec d'autres personnes.`,
+	"es": `Todos los seres humanos nacen libres e iguales en dignidad y derechos y, dotados como están de razón y conciencia, deben comportarse fraternalmente los unos con los otros.
+Hoy hacía buen tiempo, así que decidimos caminar hasta el parque y almorzar allí. ¿Qué piensas de esta idea? Me gustaría saber cómo funciona y por qué es importante.
+Por favor, escribe una función que devuelva la suma de todos los números de la lista. Este es el primer paso del proceso y debe terminarse antes de que empiece el siguiente.
+Hay muchas razones por las que la gente aprende un nuevo idioma, pero la más común es que quieren viajar y hablar con otras personas.`,
+	"pt": `Todos os seres humanos nascem livres e iguais em dignidade e em direitos. Dotados de razão e de consciência, devem agir uns para com os outros em espírito de fraternidade.
+O tempo estava bom hoje, então decidimos caminhar até o parque e almoçar lá. O que você acha desta ideia? Eu gostaria de saber como isso funciona e por que é importante.
+Por favor, escreva uma função que retorne a soma de todos os números da lista. Este é o primeiro passo do processo, e ele deve ser concluído antes que o próximo comece.
+Há muitas razões pelas quais as pessoas aprendem uma nova língua, mas a mais comum é que elas querem viajar e conversar com outras pessoas.`,
+	"it": `Tutti gli esseri umani nascono liberi ed eguali in dignità e diritti. Essi sono dotati di ragione e di coscienza e devono agire gli uni verso gli altri in spirito di fratellanza.
+Oggi il tempo era bello, quindi abbiamo deciso di camminare fino al parco e di pranzare lì. Che cosa ne pensi di questa idea? Vorrei sapere come funziona e perché è importante.
+Per favore, scrivi una funzione che restituisca la somma di tutti i numeri della lista. Questo è il primo passo del processo e deve essere completato prima che inizi il successivo.
+Ci sono molti motivi per cui le persone imparano una nuova lingua, ma il più comune è che vogliono viaggiare e parlare con altre persone.`,
+	"nl": `Alle mensen worden vrij en gelijk in waardigheid en rechten geboren. Zij zijn begiftigd met verstand en geweten, en behoren zich jegens elkander in een geest van broederschap te gedragen.
+Het weer was vandaag mooi, dus we besloten naar het park te lopen en daar te lunchen. Wat vind jij van dit idee? Ik zou graag willen weten hoe het werkt en waarom het belangrijk is.
+Schrijf alsjeblieft een functie die de som van alle getallen in de lijst teruggeeft. Dit is de eerste stap van het proces, en die moet klaar zijn voordat de volgende begint.
+Er zijn veel redenen waarom mensen een nieuwe taal leren, maar de meest voorkomende is dat ze willen reizen en met andere mensen willen praten.`,
+	"vi": `Tất cả mọi người sinh ra đều được tự do và bình đẳng về nhân phẩm và quyền lợi. Mọi con người đều được tạo hóa ban cho lý trí và lương tâm và cần phải đối xử với nhau trong tình anh em.
+Hôm nay thời tiết đẹp, vì vậy chúng tôi quyết định đi bộ đến công viên và ăn trưa ở đó. Bạn nghĩ gì về ý tưởng này? Tôi muốn biết nó hoạt động như thế nào và tại sao nó quan trọng.
+Hãy viết một hàm trả về tổng của tất cả các số trong danh sách. Đây là bước đầu tiên của quá trình, và nó cần được hoàn thành trước khi bước tiếp theo bắt đầu.
+Có nhiều lý do khiến mọi người học một ngôn ngữ mới, nhưng lý do phổ biến nhất là họ muốn đi du lịch và nói chuyện với những người khác.`,
+	"id": `Semua orang dilahirkan merdeka dan mempunyai martabat dan hak-hak yang sama. Mereka dikaruniai akal dan hati nurani dan hendaknya bergaul satu sama lain dalam semangat persaudaraan.
+Cuaca hari ini cerah, jadi kami memutuskan untuk berjalan ke taman dan makan siang di sana. Apa pendapatmu tentang ide ini? Saya ingin tahu bagaimana cara kerjanya dan mengapa hal itu penting.
+Tolong tulis sebuah fungsi yang mengembalikan jumlah semua angka di dalam daftar. Ini adalah langkah pertama dari proses tersebut, dan harus diselesaikan sebelum langkah berikutnya dimulai.
+Ada banyak alasan mengapa orang belajar bahasa baru, tetapi alasan yang paling umum adalah mereka ingin bepergian dan berbicara dengan orang lain.`,
+	"tr": `Bütün insanlar hür, haysiyet ve haklar bakımından eşit doğarlar. Akıl ve vicdana sahiptirler ve birbirlerine karşı kardeşlik zihniyeti ile hareket etmelidirler.
+Bugün hava güzeldi, bu yüzden parka yürümeye ve orada öğle yemeği yemeye karar verdik. Bu fikir hakkında ne düşünüyorsun? Nasıl çalıştığını ve neden önemli olduğunu bilmek istiyorum.
+Lütfen listedeki tüm sayıların toplamını döndüren bir fonksiyon yaz. Bu, sürecin ilk adımıdır ve bir sonraki adım başlamadan önce tamamlanmalıdır.
+İnsanların yeni bir dil öğrenmesinin birçok nedeni vardır, ancak en yaygın olanı seyahat etmek ve başka insanlarla konuşmak istemeleridir.`,
+	"pl": `Wszyscy ludzie rodzą się wolni i równi pod względem swej godności i swych praw. Są oni obdarzeni rozumem i sumieniem i powinni postępować wobec innych w duchu braterstwa.
+Dzisiaj pogoda była ładna, więc postanowiliśmy pójść pieszo do parku i zjeść tam obiad. Co myślisz o tym pomyśle? Chciałbym wiedzieć, jak to działa i dlaczego jest to ważne.
+Proszę napisz funkcję, która zwraca sumę wszystkich liczb na liście. To jest pierwszy krok procesu i powinien zostać zakończony, zanim zacznie się następny.
+Jest wiele powodów, dla których ludzie uczą się nowego języka, ale najczęstszym jest to, że chcą podróżować i rozmawiać z innymi ludźmi.`,
+}
+
+// profile holds the log probabilities of the trigrams of a language.
+type profile struct {
+	lang     string
+	logProb  map[string]float64
+	fallback float64 // log probability of unseen trigrams
+}
+
+var profiles = buildProfiles()
+
+func buildProfiles() []*profile {
+	var ps []*profile
+	for lang, sample := range samples {
+		counts := make(map[string]int)
+		total := 0
+		forEachTrigram(sample, func(tri string) {
+			counts[tri]++
+			total++
+		})
+
+		// Add-one smoothing over the observed trigrams and a generous unseen mass
+		vocab := float64(len(counts)) * 4
+		p := &profile{
+			lang:     lang,
+			logProb:  make(map[string]float64, len(counts)),
+			fallback: math.Log(1 / (float64(total) + vocab)),
+		}
+		for tri, c := range counts {
+			p.logProb[tri] = math.Log((float64(c) + 1) / (float64(total) + vocab))
+		}
+		ps = append(ps, p)
+	}
+	return ps
+}
+
+// forEachTrigram calls f for every character trigram of the lower-cased words of s,
+// with words padded by a space on both sides.
+func forEachTrigram(s string, f func(tri string)) {
+	var word []rune
+	flush := func() {
+		if len(word) == 0 {
+			return
+		}
+		padded := make([]rune, 0, len(word)+2)
+		padded = append(padded, ' ')
+		padded = append(padded, word...)
+		padded = append(padded, ' ')
+		for i := 0; i+3 <= len(padded); i++ {
+			f(string(padded[i : i+3]))
+		}
+		word = word[:0]
+	}
+
+	for _, r := range s {
+		if unicode.IsLetter(r) {
+			word = append(word, unicode.ToLower(r))
+			continue
+		}
+		flush()
+	}
+	flush()
+}
+
+// languageOfTrigrams identifies a language written in the Latin script.
+// The confidence is derived from the likelihood ratio of the best and the second best language.
+func languageOfTrigrams(s string) (string, float64) {
+	scores := make(map[*profile]float64, len(profiles))
+	n := 0
+	forEachTrigram(s, func(tri string) {
+		n++
+		for _, p := range profiles {
+			lp, ok := p.logProb[tri]
+			if !ok {
+				lp = p.fallback
+			}
+			scores[p] += lp
+		}
+	})
+	if n == 0 {
+		return "", 0
+	}
+
+	var best, second *profile
+	for _, p := range profiles {
+		switch {
+		case best == nil || scores[p] > scores[best] || (scores[p] == scores[best] && p.lang < best.lang):
+			best, second = p, best
+		case second == nil || scores[p] > scores[second]:
+			second = p
+		}
+	}
+
+	// The log-likelihood ratio of the two best languages, mapped to [0, 1)
+	return best.lang, math.Tanh((scores[best] - scores[second]) / 4)
+}
+
+// hasWords reports whether s contains at least n words of letters.
+func hasWords(s string, n int) bool {
+	return len(strings.FieldsFunc(s, func(r rune) bool { return !unicode.IsLetter(r) })) >= n
+}
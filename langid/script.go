@@ -0,0 +1,134 @@
+package langid
+
+import "unicode"
+
+// script is a writing system counted by Detect.
+type script int
+
+const (
+	scriptOther script = iota
+	scriptLatin
+	scriptHangul
+	scriptKana
+	scriptHan
+	scriptCyrillic
+	scriptGreek
+	scriptThai
+	scriptArabic
+	scriptHebrew
+	scriptDevanagari
+	numScripts
+)
+
+func scriptOf(r rune) script {
+	switch {
+	case r < 0x80:
+		if ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') {
+			return scriptLatin
+		}
+		return scriptOther
+	case unicode.Is(unicode.Latin, r):
+		return scriptLatin
+	case unicode.Is(unicode.Hangul, r):
+		return scriptHangul
+	case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+		return scriptKana
+	case unicode.Is(unicode.Han, r):
+		return scriptHan
+	case unicode.Is(unicode.Cyrillic, r):
+		return scriptCyrillic
+	case unicode.Is(unicode.Greek, r):
+		return scriptGreek
+	case unicode.Is(unicode.Thai, r):
+		return scriptThai
+	case unicode.Is(unicode.Arabic, r):
+		return scriptArabic
+	case unicode.Is(unicode.Hebrew, r):
+		return scriptHebrew
+	case unicode.Is(unicode.Devanagari, r):
+		return scriptDevanagari
+	}
+	return scriptOther
+}
+
+// scriptCounts counts the letters of each script in s.
+type scriptCounts [numScripts]int
+
+func countScripts(s string) (c scriptCounts, letters int) {
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		c[scriptOf(r)]++
+	}
+	return c, letters
+}
+
+// languageOfScripts identifies languages written in a script of their own.
+// It returns "" for the Latin script and for texts without letters.
+func languageOfScripts(c scriptCounts, letters int, s string) (string, float64) {
+	if letters == 0 {
+		return "", 0
+	}
+
+	// A Hangul syllable or a Han character carries about as much as three Latin letters.
+	weight := func(sc script) int {
+		switch sc {
+		case scriptHangul, scriptKana, scriptHan:
+			return c[sc] * 3
+		}
+		return c[sc]
+	}
+	best, total := scriptOther, weight(scriptOther)
+	for sc := scriptLatin; sc < numScripts; sc++ {
+		total += weight(sc)
+		if weight(sc) > weight(best) {
+			best = sc
+		}
+	}
+
+	share := float64(weight(best)) / float64(total)
+	switch best {
+	case scriptHangul:
+		return "ko", share
+	case scriptKana:
+		return "ja", float64(weight(scriptKana)+weight(scriptHan)) / float64(total)
+	case scriptHan:
+		// Japanese mixes kanji with a good share of kana.
+		if c[scriptKana]*5 > c[scriptKana]+c[scriptHan] {
+			return "ja", float64(weight(scriptKana)+weight(scriptHan)) / float64(total)
+		}
+		return "zh", share
+	case scriptCyrillic:
+		if containsAny(s, "іїєґІЇЄҐ") {
+			return "uk", share
+		}
+		return "ru", share
+	case scriptGreek:
+		return "el", share
+	case scriptThai:
+		return "th", share
+	case scriptArabic:
+		if containsAny(s, "پچژگ") {
+			return "fa", share
+		}
+		return "ar", share
+	case scriptHebrew:
+		return "he", share
+	case scriptDevanagari:
+		return "hi", share
+	}
+	return "", share
+}
+
+func containsAny(s, chars string) bool {
+	for _, r := range s {
+		for _, c := range chars {
+			if r == c {
+				return true
+			}
+		}
+	}
+	return false
+}
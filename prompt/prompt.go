@@ -0,0 +1,140 @@
+// Package prompt loads versioned text/template prompts with per-provider variants.
+//
+// A prompt file starts with a version comment, e.g.
+//
+//	{{/* version: 3 */ -}}
+//	Translate the following text into {{.TargetLanguage}}.
+//
+// Variants for a provider live next to the default prompt as <name>.<provider>.tmpl
+// and are selected by matching <provider> against the model name.
+package prompt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"text/template"
+)
+
+// Ext is the file extension of prompt templates.
+const Ext = ".tmpl"
+
+var ErrNotFound = errors.New("deeplingua: prompt not found")
+
+var versionComment = regexp.MustCompile(`^\{\{-?\s*/\*\s*version:\s*(\S+)\s*\*/`)
+
+// Template is a parsed prompt template.
+type Template struct {
+	Name    string
+	Version string // from the version comment of the source, "" if there is none
+	Hash    string // first 12 hex digits of the SHA-256 of the source
+
+	tmpl *template.Template
+}
+
+// Parse parses a prompt template. Executing it fails on missing map keys.
+func Parse(name, text string) (*Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256([]byte(text))
+	t := &Template{
+		Name: name,
+		Hash: hex.EncodeToString(sum[:6]),
+		tmpl: tmpl,
+	}
+	if m := versionComment.FindStringSubmatch(text); m != nil {
+		t.Version = m[1]
+	}
+	return t, nil
+}
+
+// ID identifies the template and its exact source, e.g. "translate@3-5f2a0c9be1d4".
+func (t *Template) ID() string {
+	if t.Version == "" {
+		return t.Name + "@" + t.Hash
+	}
+	return t.Name + "@" + t.Version + "-" + t.Hash
+}
+
+// Execute renders the template with data.
+func (t *Template) Execute(data any) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("deeplingua: prompt %s: %w", t.ID(), err)
+	}
+	return buf.String(), nil
+}
+
+// Set is a prompt together with its per-provider variants.
+type Set struct {
+	Default  *Template
+	Variants map[string]*Template // keyed by provider, e.g. "claude" or "gemini"
+}
+
+// For returns the variant whose provider occurs in the model name, preferring the longest match,
+// or the default template.
+func (s *Set) For(model string) *Template {
+	model = strings.ToLower(model)
+	best, bestLen := s.Default, 0
+	for provider, t := range s.Variants {
+		if len(provider) > bestLen && strings.Contains(model, strings.ToLower(provider)) {
+			best, bestLen = t, len(provider)
+		}
+	}
+	return best
+}
+
+// Load reads the prompt <name>.tmpl and its variants <name>.<provider>.tmpl from fsys.
+// The name may contain a directory, e.g. "prompts/translate".
+func Load(fsys fs.FS, name string) (*Set, error) {
+	matches, err := fs.Glob(fsys, name+".*"+Ext)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Set{Variants: make(map[string]*Template)}
+	for _, file := range append([]string{name + Ext}, matches...) {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && file == name+Ext {
+				return nil, fmt.Errorf("%w: %s", ErrNotFound, file)
+			}
+			return nil, err
+		}
+
+		t, err := Parse(strings.TrimSuffix(path.Base(file), Ext), string(data))
+		if err != nil {
+			return nil, err
+		}
+		if file == name+Ext {
+			s.Default = t
+		} else {
+			s.Variants[strings.TrimPrefix(t.Name, path.Base(name)+".")] = t
+		}
+	}
+	return s, nil
+}
+
+// LoadDir reads the prompt name and its variants from the directory dir.
+func LoadDir(dir, name string) (*Set, error) {
+	return Load(os.DirFS(dir), name)
+}
+
+// MustLoad is like Load but panics on error. It is meant for embedded prompts.
+func MustLoad(fsys fs.FS, name string) *Set {
+	s, err := Load(fsys, name)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
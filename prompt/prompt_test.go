@@ -0,0 +1,51 @@
+package prompt_test
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"gosuda.org/deeplingua/prompt"
+)
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"prompts/translate.tmpl":        {Data: []byte("{{/* version: 2 */ -}}\nTranslate into {{.Lang}}.")},
+		"prompts/translate.claude.tmpl": {Data: []byte("{{/* version: 2 */ -}}\nPlease translate into {{.Lang}}.")},
+		"prompts/translate_judge.tmpl":  {Data: []byte("unrelated")},
+	}
+	s, err := prompt.Load(fsys, "prompts/translate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Variants) != 1 || s.Variants["claude"] == nil {
+		t.Fatalf("variants = %v, want claude", s.Variants)
+	}
+
+	for model, want := range map[string]string{
+		"gemini-2.0-flash":  "Translate into Korean.",
+		"claude-3-5-sonnet": "Please translate into Korean.",
+	} {
+		got, err := s.For(model).Execute(map[string]string{"Lang": "Korean"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("For(%q) = %q, want %q", model, got, want)
+		}
+	}
+
+	if s.Default.Version != "2" || s.Default.ID() != "translate@2-"+s.Default.Hash {
+		t.Errorf("ID() = %q", s.Default.ID())
+	}
+	if s.Default.Hash == s.Variants["claude"].Hash {
+		t.Errorf("variants with different sources have the same hash")
+	}
+
+	if _, err := s.Default.Execute(map[string]string{}); err == nil {
+		t.Errorf("Execute() with a missing key succeeded")
+	}
+	if _, err := prompt.Load(fsys, "prompts/missing"); !errors.Is(err, prompt.ErrNotFound) {
+		t.Errorf("Load() of a missing prompt = %v, want ErrNotFound", err)
+	}
+}
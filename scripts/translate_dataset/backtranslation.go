@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fastjson"
+	"gosuda.org/deeplingua/evaluate"
+	"gosuda.org/deeplingua/internal/toolcall"
+	"gosuda.org/deeplingua/internal/translate"
+	"gosuda.org/deeplingua/normalize"
+)
+
+// backTranslate scores every translation of messages that has no back-translation score yet
+// and reports whether any score is below the threshold. Scores are kept on the messages,
+// so a retry after an error only scores the remaining translations. The tokens used are added to usage.
+// Messages with tool blocks are not scored, since chrF over their JSON says little about the prose.
+func backTranslate(ctx context.Context, inLang string, outLangs []string, messages []*fastjson.Value, usage translate.ModelUsage) (rejected bool, err error) {
+	for i, message := range messages {
+		original := string(message.GetStringBytes("content"))
+		if !utf8.ValidString(original) {
+			continue
+		}
+		original = normalize.Normalize(original)
+		if toolCalls && toolcall.Parse(original, nil, toolRoles[string(message.GetStringBytes("role"))]).HasTools() {
+			continue
+		}
+
+		for _, lang := range outLangs {
+			scoreField := targetField("back_translation_score", lang, outLangs)
+			if message.Exists(scoreField) {
+				rejected = rejected || message.GetFloat64(scoreField) < backTranslation.Threshold
+				continue
+			}
+			translated := string(message.GetStringBytes(targetField("translated_content", lang, outLangs)))
+			if translated == "" || message.GetBool(targetField("translation_skipped", lang, outLangs)) {
+				continue
+			}
+
+			bt, err := evaluate.EvaluateBackTranslation(ctx, original, translated, inLang, lang, backTranslator)
+			if err != nil {
+				usage.Merge(translate.UsageOf(err))
+				return false, err
+			}
+			usage.Merge(bt.Usage)
+			message.Set(scoreField, fastjson.MustParse(strconv.FormatFloat(bt.Score, 'f', -1, 64)))
+			if bt.Score < backTranslation.Threshold {
+				log.Warn().Int("message", i).Str("lang", lang).Float64("score", bt.Score).Msg("back-translation below threshold")
+				rejected = true
+			}
+		}
+	}
+	return rejected, nil
+}
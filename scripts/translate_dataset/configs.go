@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"errors"
+	"maps"
+	"time"
 
 	"github.com/lemon-mint/coord"
 	"github.com/lemon-mint/coord/llm"
@@ -13,12 +16,58 @@ import (
 	_ "github.com/lemon-mint/coord/provider/vertexai"
 	"github.com/rs/zerolog/log"
 	"golang.org/x/time/rate"
+	"gosuda.org/deeplingua/internal/cache"
+	"gosuda.org/deeplingua/internal/chunk"
+	"gosuda.org/deeplingua/internal/judge"
+	"gosuda.org/deeplingua/internal/mask"
+	"gosuda.org/deeplingua/internal/translate"
+	"gosuda.org/deeplingua/prompt"
 )
 
 type Configs struct {
-	Models       []Model `json:"models,omitempty"`
-	StartIndex   int     `json:"start_index,omitempty"`
-	CustomPrompt *string `json:"custom_prompt,omitempty"`
+	Models           []Model `json:"models,omitempty"`
+	JudgeModels      []Model `json:"judge_models,omitempty"`
+	StartIndex       int     `json:"start_index,omitempty"`
+	CustomPrompt     *string `json:"custom_prompt,omitempty"`
+	PromptDir        string  `json:"prompt_dir,omitempty"`
+	CacheDir         string  `json:"cache_dir,omitempty"`
+	SharedCache      bool    `json:"shared_cache,omitempty"` // reuse cached translations across models
+	ChunkConcurrency int     `json:"chunk_concurrency,omitempty"`
+	ContextWindow    int     `json:"context_window,omitempty"`
+	ChunkTokens      int     `json:"chunk_tokens,omitempty"`
+	SplitDepth       *int    `json:"split_depth,omitempty"`
+
+	Domain             string `json:"domain,omitempty"`
+	Register           string `json:"register,omitempty"` // name of a register profile, or a description of the register
+	SkipTargetLanguage bool   `json:"skip_target_language,omitempty"`
+	SkipCode           bool   `json:"skip_code,omitempty"`
+	ToolCalls          bool   `json:"tool_calls,omitempty"` // translate only natural-language values of tool definitions, calls and results
+
+	Masking          bool     `json:"masking,omitempty"`
+	ValidateMarkdown bool     `json:"validate_markdown,omitempty"`
+	ValidateEntities bool     `json:"validate_entities,omitempty"`
+	EntityKinds      []string `json:"entity_kinds,omitempty"` // e.g. "number" or "proper_noun" (default: all but proper_noun)
+	Validation       string   `json:"validation,omitempty"`   // "retry" (default) or "flag"
+
+	Alignment string       `json:"alignment,omitempty"` // "chunk" or "paragraph"
+	Retry     *RetryConfig `json:"retry,omitempty"`
+
+	Conversation *ConversationConfig `json:"conversation,omitempty"`
+	Reasoning    *ReasoningConfig    `json:"reasoning,omitempty"`
+
+	Refine     *RefineConfig     `json:"refine,omitempty"`
+	Candidates *CandidatesConfig `json:"candidates,omitempty"`
+
+	BackTranslation *BackTranslationConfig `json:"back_translation,omitempty"`
+
+	Prices translate.Prices `json:"prices,omitempty"` // per million tokens, keyed by a part of the model name
+
+	Glossary     *translate.Glossary `json:"glossary,omitempty"`
+	GlossaryPath string              `json:"glossary_path,omitempty"`
+
+	RoleRegisters        map[string]string  `json:"role_registers,omitempty"` // role -> register, overriding register
+	RegisterProfiles     translate.Profiles `json:"register_profiles,omitempty"`
+	RegisterProfilesPath string             `json:"register_profiles_path,omitempty"`
 }
 
 type Model struct {
@@ -33,13 +82,252 @@ type Model struct {
 	BaseURL     string   `json:"base_url,omitempty"`
 }
 
+// ConversationConfig configures the translation of messages with the earlier turns of their conversation as context.
+type ConversationConfig struct {
+	Turns     int `json:"turns,omitempty"`      // earlier turns passed along (default: 6)
+	MaxTokens int `json:"max_tokens,omitempty"` // estimated tokens of the turns passed along (default: 2048)
+}
+
+// ReasoningConfig configures the translation of the reasoning of models, in <think> blocks
+// of the content and in reasoning fields of messages.
+type ReasoningConfig struct {
+	Policy      string   `json:"policy,omitempty"`       // "translate" (default), "keep" or "separate"
+	ChunkTokens int      `json:"chunk_tokens,omitempty"` // token budget of reasoning chunks under "separate" (default: chunk_tokens)
+	Fields      []string `json:"fields,omitempty"`       // message fields holding reasoning, e.g. "reasoning_content"
+}
+
+// RefineConfig configures the judge-guided refinement of translations. Scores range from 0 to 1.
+type RefineConfig struct {
+	Threshold     float64 `json:"threshold,omitempty"`
+	MaxIterations int     `json:"max_iterations,omitempty"`
+}
+
+// CandidatesConfig configures best-of-N translation of chunks.
+type CandidatesConfig struct {
+	Count    int     `json:"count,omitempty"`
+	Models   []Model `json:"models,omitempty"`   // candidate models used in turn, e.g. with a higher temperature (default: models)
+	Selector string  `json:"selector,omitempty"` // "validators" (default) or "judge"
+	Keep     bool    `json:"keep,omitempty"`     // store every candidate and its score per message
+}
+
+// BackTranslationConfig configures the back-translation quality check. Scores are chrF from 0 to 1.
+type BackTranslationConfig struct {
+	Threshold float64 `json:"threshold,omitempty"` // rows with a lower score are written to the .failed file
+	Models    []Model `json:"models,omitempty"`    // default: models
+}
+
+// RetryConfig configures the exponential backoff of chunk translations. Durations are in seconds.
+type RetryConfig struct {
+	MaxAttempts       int     `json:"max_attempts,omitempty"`
+	RateLimitAttempts int     `json:"rate_limit_attempts,omitempty"`
+	BaseDelay         float64 `json:"base_delay,omitempty"`
+	MaxDelay          float64 `json:"max_delay,omitempty"`
+	MaxElapsed        float64 `json:"max_elapsed,omitempty"`
+}
+
+func (c *RetryConfig) Policy() translate.RetryPolicy {
+	p := *translate.DefaultRetryPolicy.(*translate.ExponentialBackoff)
+	p.Budgets = maps.Clone(p.Budgets)
+
+	if c.MaxAttempts > 0 {
+		p.MaxAttempts = c.MaxAttempts
+	}
+	if c.RateLimitAttempts > 0 {
+		p.Budgets[translate.ErrorRateLimited] = c.RateLimitAttempts
+	}
+	if c.BaseDelay > 0 {
+		p.BaseDelay = seconds(c.BaseDelay)
+	}
+	if c.MaxDelay > 0 {
+		p.MaxDelay = seconds(c.MaxDelay)
+	}
+	if c.MaxElapsed > 0 {
+		p.MaxElapsed = seconds(c.MaxElapsed)
+	}
+	return &p
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
 func ApplyConfig(c *Configs) {
 	if c == nil {
 		return
 	}
 
-	models := make([]llm.Model, 0, len(c.Models))
-	for i, m := range c.Models {
+	translationModel = newModel(c.Models)
+	if len(c.JudgeModels) > 0 {
+		evaluationModel = newModel(c.JudgeModels)
+	}
+	if c.Refine != nil {
+		if evaluationModel == nil {
+			log.Fatal().Msg("refine requires judge_models")
+		}
+		refine = c.Refine
+	}
+	if c.Candidates != nil {
+		switch c.Candidates.Selector {
+		case "", "validators":
+			candidateScorer = translate.ViolationScorer{}
+		case "judge":
+			if evaluationModel == nil {
+				log.Fatal().Msg("the judge selector requires judge_models")
+			}
+			candidateScorer = translate.JudgeScorer{Evaluator: &judge.Evaluator{Model: evaluationModel}}
+		default:
+			log.Fatal().Str("selector", c.Candidates.Selector).Msg(`candidate selector must be "validators" or "judge"`)
+		}
+		candidates = c.Candidates.Count
+		keepCandidates = c.Candidates.Keep
+		for _, m := range c.Candidates.Models {
+			candidateModels = append(candidateModels, newModel([]Model{m}))
+		}
+	}
+	if c.BackTranslation != nil {
+		backTranslation = c.BackTranslation
+		backTranslationModel = translationModel
+		if len(c.BackTranslation.Models) > 0 {
+			backTranslationModel = newModel(c.BackTranslation.Models)
+		}
+	}
+
+	prices = c.Prices
+	startIndex = c.StartIndex
+	if c.CustomPrompt != nil {
+		customPrompt = *c.CustomPrompt
+	}
+	if c.PromptDir != "" {
+		p, err := prompt.LoadDir(c.PromptDir, "translate")
+		if err != nil {
+			log.Fatal().Err(err).Str("path", c.PromptDir).Msg("failed to load prompt")
+		}
+		translationPrompt = p
+
+		p, err = prompt.LoadDir(c.PromptDir, "reasoning")
+		switch {
+		case err == nil:
+			reasoningPrompt = p
+		case !errors.Is(err, prompt.ErrNotFound):
+			log.Fatal().Err(err).Str("path", c.PromptDir).Msg("failed to load reasoning prompt")
+		}
+	}
+	if c.CacheDir != "" {
+		store, err := cache.Open(c.CacheDir)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", c.CacheDir).Msg("failed to open translation cache")
+		}
+		log.Info().Str("path", c.CacheDir).Int("entries", store.Len()).Msg("opened translation cache")
+		translationCache = store
+	}
+	sharedCache = c.SharedCache
+	if c.ChunkConcurrency > 0 {
+		chunkConcurrency = c.ChunkConcurrency
+	}
+	contextWindow = c.ContextWindow
+	chunkTokens = c.ChunkTokens
+	if c.SplitDepth != nil {
+		splitDepth = *c.SplitDepth
+	}
+
+	domain = c.Domain
+	conversation = c.Conversation
+	if c.Reasoning != nil {
+		switch c.Reasoning.Policy {
+		case "", "translate":
+			reasoningPolicy = translate.ReasoningTranslate
+		case "keep":
+			reasoningPolicy = translate.ReasoningKeep
+		case "separate":
+			reasoningPolicy = translate.ReasoningSeparate
+		default:
+			log.Fatal().Str("policy", c.Reasoning.Policy).Msg(`reasoning policy must be "translate", "keep" or "separate"`)
+		}
+		if n := c.Reasoning.ChunkTokens; n > 0 {
+			reasoningChunker = func(input string) []string {
+				return chunk.ChunkMarkdownTokens(input, n)
+			}
+		}
+		reasoningFields = c.Reasoning.Fields
+		for _, field := range reasoningFields {
+			targetFields = append(targetFields, "translated_"+field)
+		}
+	}
+	register = c.Register
+	roleRegisters = c.RoleRegisters
+	registerProfiles = c.RegisterProfiles
+	if c.RegisterProfilesPath != "" {
+		p, err := translate.LoadProfiles(c.RegisterProfilesPath)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", c.RegisterProfilesPath).Msg("failed to load register profiles")
+		}
+		registerProfiles = registerProfiles.With(p)
+	}
+	skipTargetLanguage = c.SkipTargetLanguage
+	skipCode = c.SkipCode
+	toolCalls = c.ToolCalls
+
+	if c.Retry != nil {
+		retryPolicy = c.Retry.Policy()
+	}
+
+	switch c.Alignment {
+	case "", "chunk", "paragraph":
+		alignment = c.Alignment
+	default:
+		log.Fatal().Str("alignment", c.Alignment).Msg(`alignment must be "chunk" or "paragraph"`)
+	}
+
+	if c.Masking {
+		masking = mask.All
+	}
+	if c.ValidateMarkdown {
+		validators = append(validators, translate.MarkdownValidator{})
+	}
+	if c.ValidateEntities {
+		var kinds translate.EntityKind
+		for _, name := range c.EntityKinds {
+			kind, ok := entityKinds[name]
+			if !ok {
+				log.Fatal().Str("kind", name).Msg("unknown entity kind")
+			}
+			kinds |= kind
+		}
+		validators = append(validators, translate.EntityValidator{Kinds: kinds})
+	}
+	switch c.Validation {
+	case "", "retry":
+		validationPolicy = translate.ValidationRetry
+	case "flag":
+		validationPolicy = translate.ValidationFlag
+	default:
+		log.Fatal().Str("validation", c.Validation).Msg(`validation must be "retry" or "flag"`)
+	}
+
+	glossary = c.Glossary
+	if c.GlossaryPath != "" {
+		g, err := translate.LoadGlossary(c.GlossaryPath)
+		if err != nil {
+			log.Fatal().Err(err).Str("path", c.GlossaryPath).Msg("failed to load glossary")
+		}
+		glossary = g
+	}
+}
+
+var entityKinds = map[string]translate.EntityKind{
+	"url":         translate.EntityURL,
+	"email":       translate.EntityEmail,
+	"version":     translate.EntityVersion,
+	"date":        translate.EntityDate,
+	"currency":    translate.EntityCurrency,
+	"number":      translate.EntityNumber,
+	"proper_noun": translate.EntityProperNoun,
+}
+
+// newModel creates the models of ms, balancing the requests across them.
+func newModel(ms []Model) *LoadBalancingModel {
+	models := make([]llm.Model, 0, len(ms))
+	for i, m := range ms {
 		var client provider.LLMClient
 		var options []pconf.Config
 		var err error
@@ -103,11 +391,5 @@ func ApplyConfig(c *Configs) {
 		}
 		models = append(models, model)
 	}
-	model := NewLoadBalancingModel(models...)
-	translationModel = model
-
-	startIndex = c.StartIndex
-	if c.CustomPrompt != nil {
-		customPrompt = *c.CustomPrompt
-	}
+	return NewLoadBalancingModel(models...)
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"unicode/utf8"
+
+	"github.com/valyala/fastjson"
+	"gosuda.org/deeplingua/internal/translate"
+	"gosuda.org/deeplingua/normalize"
+)
+
+const (
+	defaultConversationTurns  = 6    // earlier turns passed along
+	defaultConversationTokens = 2048 // estimated tokens of the turns passed along
+)
+
+// conversationHistory returns up to conversation.Turns of the last messages as turns, together
+// with their translations into every target language translated so far, keeping the estimated
+// tokens of the turns within conversation.MaxTokens. Messages whose translation was skipped carry
+// their source as translation, so they are left out of the history of that language.
+func conversationHistory(messages []*fastjson.Value, outLangs []string) []translate.Turn {
+	maxTurns, maxTokens := conversation.Turns, conversation.MaxTokens
+	if maxTurns <= 0 {
+		maxTurns = defaultConversationTurns
+	}
+	if maxTokens <= 0 {
+		maxTokens = defaultConversationTokens
+	}
+
+	var turns []translate.Turn
+	tokens := 0
+	for i := len(messages) - 1; i >= 0 && len(turns) < maxTurns; i-- {
+		message := messages[i]
+		text := string(message.GetStringBytes("content"))
+		if text == "" || !utf8.ValidString(text) {
+			continue
+		}
+
+		turn := translate.Turn{
+			Role:         string(message.GetStringBytes("role")),
+			Text:         normalize.Normalize(text),
+			Translations: make(map[string]string, len(outLangs)),
+		}
+		// Only one translation of a turn goes into each prompt, so the longest one is counted.
+		translationTokens := 0
+		for _, lang := range outLangs {
+			if message.GetBool(targetField("translation_skipped", lang, outLangs)) {
+				continue
+			}
+			if translated := message.GetStringBytes(targetField("translated_content", lang, outLangs)); len(translated) > 0 {
+				turn.Translations[lang] = string(translated)
+				translationTokens = max(translationTokens, estimateTokens(string(translated)))
+			}
+		}
+		if len(turn.Translations) == 0 {
+			continue
+		}
+
+		tokens += estimateTokens(turn.Text) + translationTokens
+		if tokens > maxTokens {
+			break
+		}
+		turns = append(turns, turn)
+	}
+
+	for i, j := 0, len(turns)-1; i < j; i, j = i+1, j-1 {
+		turns[i], turns[j] = turns[j], turns[i]
+	}
+	return turns
+}
+
+// estimateTokens estimates the tokens of s as a token per four ASCII characters
+// and a token per other character, which errs on the high side for most scripts.
+func estimateTokens(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return (ascii+3)/4 + other
+}
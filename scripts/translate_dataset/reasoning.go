@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"unicode/utf8"
+
+	"github.com/valyala/fastjson"
+	"gosuda.org/deeplingua/internal/translate"
+	"gosuda.org/deeplingua/normalize"
+)
+
+// translateReasoning translates the reasoning fields of messages into every target language that
+// has no translation yet, storing it in "translated_<field>". Translations are kept on the messages,
+// so a retry after an error only translates the remaining ones. The tokens used are added to usage.
+func translateReasoning(ctx context.Context, inLang string, outLangs []string, messages []*fastjson.Value, usage translate.ModelUsage) error {
+	for _, message := range messages {
+		role := string(message.GetStringBytes("role"))
+		for _, field := range reasoningFields {
+			original := string(message.GetStringBytes(field))
+			if original == "" || !utf8.ValidString(original) {
+				continue
+			}
+			original = normalize.Normalize(original)
+
+			var targets []string
+			for _, lang := range outLangs {
+				if !message.Exists(targetField("translated_"+field, lang, outLangs)) {
+					targets = append(targets, lang)
+				}
+			}
+			if len(targets) == 0 {
+				continue
+			}
+
+			results, err := translator.TranslateTargets(ctx, &translate.Request{
+				Text:           original,
+				SourceLanguage: inLang,
+				Register:       roleRegisters[role],
+				Role:           role,
+				Reasoning:      true,
+			}, targets)
+			usage.Merge(translate.UsageOf(err))
+			for lang, result := range results {
+				usage.Merge(result.Usage)
+				if !utf8.ValidString(result.Text) {
+					continue
+				}
+				data, err := json.Marshal(normalize.Normalize(result.Text))
+				if err != nil {
+					return err
+				}
+				message.Set(targetField("translated_"+field, lang, outLangs), fastjson.MustParseBytes(data))
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/valyala/fastjson"
+	"gosuda.org/deeplingua/jsonl"
+	"gosuda.org/deeplingua/langid"
+)
+
+// targetFields are the message fields written once per target language.
+var targetFields = []string{
+	"translated_content", "translation_skipped", "translation_violations", "translation_segments",
+	"translation_score", "translation_refinements", "translation_candidates", "translation_register", "prompt_id",
+	"translation_usage", "back_translation_score",
+}
+
+// targetField returns the name of a per-language message field. With a single target language
+// the name is unchanged, otherwise the language code is appended, e.g. "translated_content_ko".
+func targetField(name, lang string, outLangs []string) string {
+	if len(outLangs) == 1 {
+		return name
+	}
+	return name + "_" + langid.Code(lang)
+}
+
+// parseLanguages splits a comma-separated list of languages.
+func parseLanguages(s string) []string {
+	var langs []string
+	for _, lang := range strings.Split(s, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// languageFile returns the output file of lang, e.g. "out.ko.jsonl" for "out.jsonl".
+func languageFile(outFile, lang string) string {
+	ext := filepath.Ext(outFile)
+	return strings.TrimSuffix(outFile, ext) + "." + langid.Code(lang) + ext
+}
+
+type valueWriter interface {
+	Write(v *jsonl.Value) error
+}
+
+// splitWriter writes every row to one file per target language,
+// keeping only the fields of that language under their plain names.
+type splitWriter struct {
+	outLangs []string
+	writers  []*jsonl.Writer // in the order of outLangs
+}
+
+func (s *splitWriter) Write(v *jsonl.Value) error {
+	data := v.MarshalTo(nil)
+	for i, lang := range s.outLangs {
+		parsed, err := fastjson.ParseBytes(data)
+		if err != nil {
+			return err
+		}
+		view := &jsonl.Value{Value: parsed}
+		for _, message := range view.GetArray("messages") {
+			for _, name := range targetFields {
+				for _, other := range s.outLangs {
+					field := targetField(name, other, s.outLangs)
+					if field == name {
+						continue
+					}
+					if other == lang {
+						if fv := message.Get(field); fv != nil {
+							message.Set(name, fv)
+						}
+					}
+					message.Del(field)
+				}
+			}
+		}
+		if err := s.writers[i].Write(view); err != nil {
+			return err
+		}
+	}
+	return nil
+}
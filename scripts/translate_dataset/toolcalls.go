@@ -0,0 +1,52 @@
+package main
+
+import (
+	"github.com/valyala/fastjson"
+	"gosuda.org/deeplingua/internal/toolcall"
+	"gosuda.org/deeplingua/jsonl"
+)
+
+// toolRoles are the roles of messages holding the result of a tool call.
+var toolRoles = map[string]bool{
+	"tool":        true,
+	"function":    true,
+	"observation": true,
+	"ipython":     true,
+}
+
+// rowTools returns the tools defined in the "tools" field of the row, given as JSON or as a JSON string.
+func rowTools(v *jsonl.Value) toolcall.Tools {
+	field := v.Get("tools")
+	if field == nil {
+		return make(toolcall.Tools)
+	}
+	data := field.MarshalTo(nil)
+	if field.Type() == fastjson.TypeString {
+		data = field.GetStringBytes()
+	}
+	tools, err := toolcall.ParseTools(string(data))
+	if err != nil {
+		return make(toolcall.Tools)
+	}
+	return tools
+}
+
+// toolDocument parses the tool blocks of a message and adds the tools it defines to tools.
+// It returns nil if the message has no tool blocks.
+func toolDocument(content, role string, tools toolcall.Tools) *toolcall.Document {
+	doc := toolcall.Parse(content, tools, toolRoles[role])
+	if !doc.HasTools() {
+		return nil
+	}
+	tools.Add(doc.Definitions())
+	return doc
+}
+
+// renderTools returns the translation of doc from the translation of its batched texts.
+func renderTools(doc *toolcall.Document, translated string) (string, error) {
+	texts, err := toolcall.Unbatch(translated, len(doc.Texts()))
+	if err != nil {
+		return "", err
+	}
+	return doc.Render(texts)
+}
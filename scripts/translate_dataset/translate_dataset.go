@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -10,6 +11,8 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"syscall"
@@ -20,14 +23,22 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 	"github.com/valyala/fastjson"
+	"gosuda.org/deeplingua/internal/cache"
+	"gosuda.org/deeplingua/internal/chunk"
+	"gosuda.org/deeplingua/internal/judge"
+	"gosuda.org/deeplingua/internal/mask"
+	"gosuda.org/deeplingua/internal/toolcall"
 	"gosuda.org/deeplingua/internal/translate"
 	"gosuda.org/deeplingua/jsonl"
+	"gosuda.org/deeplingua/langid"
 	"gosuda.org/deeplingua/normalize"
+	"gosuda.org/deeplingua/prompt"
 )
 
 var (
 	translationModel  llm.Model                                     // required
 	customPrompt      string                                        // required
+	translator        *translate.Translator                         // required (built from translationModel and customPrompt)
 	evaluationModel   llm.Model                             = nil   // optional
 	doEvaluation      bool                                  = false // optional
 	customPipelinePre func(index int, v *jsonl.Value) error = func(index int, v *jsonl.Value) error {
@@ -42,10 +53,67 @@ var (
 	startIndex         int                                   = 0 // optional
 )
 
+// Language identification options (set by ApplyConfig)
+var (
+	skipTargetLanguage bool // optional (messages already in the target language are not translated)
+	skipCode           bool // optional (messages without natural language, e.g. pure code, are not translated)
+	toolCalls          bool // optional (only natural-language values of tool definitions, calls and results are translated)
+)
+
+// Output options (set by ApplyConfig)
+var (
+	alignment string           // optional ("chunk" or "paragraph": aligned source and translated segments stored per message)
+	prices    translate.Prices // optional (cost of the token usage)
+)
+
+// Evaluation options (set by ApplyConfig)
+var (
+	backTranslation      *BackTranslationConfig // optional (translations translated back and scored with chrF)
+	backTranslationModel llm.Model              // optional (default: translationModel)
+	backTranslator       *translate.Translator  // optional (built from backTranslationModel)
+)
+
+// Reasoning options (set by ApplyConfig)
+var (
+	reasoningPolicy  translate.ReasoningPolicy                                    // optional (reasoning translated, kept or translated separately)
+	reasoningChunker translate.Chunker                                            // optional (chunks reasoning under the separate policy)
+	reasoningPrompt  *prompt.Set               = translate.DefaultReasoningPrompt // optional (loaded from prompt_dir)
+	reasoningFields  []string                                                     // optional (message fields holding reasoning, translated into translated_<field>)
+)
+
+// Translator options (set by ApplyConfig)
+var (
+	translationPrompt *prompt.Set                = translate.DefaultPrompt      // optional (loaded from prompt_dir)
+	chunkConcurrency  int                        = 1                            // optional (chunks of one message translated in parallel)
+	contextWindow     int                        = 0                            // optional (preceding chunks passed as context, disables chunkConcurrency)
+	chunkTokens       int                        = chunk.DefaultMaxTokens       // optional (token budget of a chunk)
+	splitDepth        int                        = translate.DefaultSplitDepth  // optional (times a truncated chunk is split in half)
+	refine            *RefineConfig                                             // optional (translations judged by evaluationModel and refined)
+	candidates        int                                                       // optional (candidate translations per chunk, best-of-N)
+	candidateModels   []llm.Model                                               // optional (models producing the candidates)
+	candidateScorer   translate.Scorer                                          // optional (picks the best candidate)
+	keepCandidates    bool                                                      // optional (candidates stored per message)
+	translationCache  *cache.Store                                              // optional (chunk translations reused across rows and runs)
+	sharedCache       bool                                                      // optional (cached translations shared by all models)
+	glossary          *translate.Glossary                                       // optional
+	retryPolicy       translate.RetryPolicy      = translate.DefaultRetryPolicy // optional
+	domain            string                                                    // optional (subject area added to the prompt)
+	register          string                                                    // optional (register profile or description, default formal)
+	roleRegisters     map[string]string                                         // optional (register of the messages of a role)
+	conversation      *ConversationConfig                                       // optional (earlier turns and their translations passed as context)
+	registerProfiles  translate.Profiles                                        // optional (added to the built-in profiles)
+	masking           mask.Kind                                                 // optional (spans replaced by tokens before translation)
+	validators        []translate.Validator                                     // optional (checks run on every translated chunk)
+	validationPolicy  translate.ValidationPolicy                                // optional (chunks failing validation are retried or flagged)
+)
+
 var (
 	lastReadIndex          atomic.Int64
 	successfulTranslations atomic.Int64
 	failedTranslations     atomic.Int64
+	rejectedTranslations   atomic.Int64
+	cachedChunks           atomic.Int64
+	runUsage               translate.UsageCounter
 )
 
 type Job struct {
@@ -61,17 +129,20 @@ func main() {
 	var outFile string
 	var inLang string
 	var outLang string
+	var split bool
 	var workers int
 
 	flag.StringVar(&inFile, "in", "", "Input file")
 	flag.StringVar(&outFile, "out", "", "Output file")
 	flag.StringVar(&inLang, "src", "", "Source language")
-	flag.StringVar(&outLang, "dst", "", "Target language")
+	flag.StringVar(&outLang, "dst", "", "Target languages, comma-separated")
+	flag.BoolVar(&split, "split", false, "Write one output file per target language")
 	flag.IntVar(&workers, "workers", 256, "Workers")
 	flag.Parse()
 	if inFile == "" || outFile == "" || inLang == "" || outLang == "" {
-		panic("Usage: translate_dataset -in <input.jsonl> -out <output.jsonl> -src <source_lang> -dst <target_lang>")
+		panic("Usage: translate_dataset -in <input.jsonl> -out <output.jsonl> -src <source_lang> -dst <target_lang>[,<target_lang>...] [-split]")
 	}
+	outLangs := parseLanguages(outLang)
 
 	// Load configuration
 	var err error
@@ -92,7 +163,58 @@ func main() {
 	}
 	ApplyConfig(&config)
 
-	log.Info().Str("in", inFile).Str("out", outFile).Str("src", inLang).Str("dst", outLang).Int("workers", workers).Msg("starting")
+	translatorOptions := []translate.Option{
+		translate.WithPrompt(translationPrompt),
+		translate.WithCustomPrompt(customPrompt),
+		translate.WithDomain(domain),
+		translate.WithRegister(register),
+		translate.WithRegisterProfiles(registerProfiles),
+		translate.WithConcurrency(chunkConcurrency),
+		translate.WithContextWindow(contextWindow),
+		translate.WithChunkTokens(chunkTokens),
+		translate.WithReasoning(reasoningPolicy, reasoningChunker),
+		translate.WithReasoningPrompt(reasoningPrompt),
+		translate.WithSplitDepth(splitDepth),
+		translate.WithGlossary(glossary),
+		translate.WithMasking(masking),
+		translate.WithValidationPolicy(validationPolicy),
+		translate.WithRetryPolicy(retryPolicy),
+		translate.WithUsageRecorder(&runUsage),
+		translate.WithLogger(log.Logger),
+	}
+	for _, v := range validators {
+		translatorOptions = append(translatorOptions, translate.WithValidator(v))
+	}
+	if refine != nil {
+		translatorOptions = append(translatorOptions, translate.WithRefinement(&judge.Evaluator{Model: evaluationModel}, refine.Threshold, refine.MaxIterations))
+	}
+	if candidates > 1 {
+		translatorOptions = append(translatorOptions, translate.WithCandidates(candidates, candidateScorer, keepCandidates, candidateModels...))
+	}
+	if translationCache != nil {
+		defer translationCache.Close()
+		translatorOptions = append(translatorOptions, translate.WithCache(translationCache), translate.WithSharedCache(sharedCache))
+	}
+	translator = translate.New(translationModel, translatorOptions...)
+	if backTranslation != nil {
+		// The back-translation is only a quality signal, so it skips refinement and candidates.
+		backOptions := []translate.Option{
+			translate.WithConcurrency(chunkConcurrency),
+			translate.WithChunkTokens(chunkTokens),
+			translate.WithSplitDepth(splitDepth),
+			translate.WithMasking(masking),
+			translate.WithRetryPolicy(retryPolicy),
+			translate.WithUsageRecorder(&runUsage),
+			translate.WithLogger(log.Logger),
+		}
+		if translationCache != nil {
+			backOptions = append(backOptions, translate.WithCache(translationCache), translate.WithSharedCache(sharedCache))
+		}
+		backTranslator = translate.New(backTranslationModel, backOptions...)
+	}
+
+	log.Info().Str("prompt", translationPrompt.Default.ID()).Int("variants", len(translationPrompt.Variants)).Msg("loaded prompt")
+	log.Info().Str("in", inFile).Str("out", outFile).Str("src", inLang).Strs("dst", outLangs).Int("workers", workers).Msg("starting")
 
 	f, err := os.Open(inFile)
 	if err != nil {
@@ -106,17 +228,38 @@ func main() {
 	}
 	defer r.Close()
 
-	wf, err := os.Create(outFile)
-	if err != nil {
-		panic(err)
-	}
-	defer wf.Close()
+	var w valueWriter
+	if split && len(outLangs) > 1 {
+		sw := &splitWriter{outLangs: outLangs}
+		for _, lang := range outLangs {
+			wf, err := os.Create(languageFile(outFile, lang))
+			if err != nil {
+				panic(err)
+			}
+			defer wf.Close()
 
-	w, err := jsonl.NewWriter(wf)
-	if err != nil {
-		panic(err)
+			lw, err := jsonl.NewWriter(wf)
+			if err != nil {
+				panic(err)
+			}
+			defer lw.Close()
+			sw.writers = append(sw.writers, lw)
+		}
+		w = sw
+	} else {
+		wf, err := os.Create(outFile)
+		if err != nil {
+			panic(err)
+		}
+		defer wf.Close()
+
+		jw, err := jsonl.NewWriter(wf)
+		if err != nil {
+			panic(err)
+		}
+		defer jw.Close()
+		w = jw
 	}
-	defer w.Close()
 
 	wfailf, err := os.Create(outFile + ".failed")
 	if err != nil {
@@ -134,6 +277,8 @@ func main() {
 	var wgWriter sync.WaitGroup  // Wait for writer to finish
 
 	stopSignal := make(chan struct{})
+	ctx, forceStop := context.WithCancel(context.Background())
+	defer forceStop()
 	jobQueue := make(chan Job, 1)
 	errorQueue := make(chan *jsonl.Value, workers*2)
 	completionQueue := make(chan *jsonl.Value, workers*2)
@@ -141,7 +286,7 @@ func main() {
 	// Start Translation Workers
 	wgWorkers.Add(workers)
 	for i := 0; i < workers; i++ {
-		go translationWorker(i, inLang, outLang, jobQueue, completionQueue, errorQueue, &wgWorkers)
+		go translationWorker(ctx, i, inLang, outLangs, jobQueue, completionQueue, errorQueue, &wgWorkers)
 	}
 
 	// Start Writer Worker
@@ -157,8 +302,11 @@ func main() {
 		signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 		<-sigChan
 		close(stopSignal)
-		signal.Stop(sigChan)
 		log.Info().Msg("received stop signal, gracefully stopping remaining workers... (interrupt again to force stop)")
+		<-sigChan
+		signal.Stop(sigChan)
+		forceStop()
+		log.Info().Msg("received second stop signal, cancelling in-flight translations")
 	}()
 
 	wgWorkers.Wait() // Wait for all workers to finish translation
@@ -170,9 +318,25 @@ func main() {
 	log.Debug().Msg("writer worker stopped")
 
 	// Print statistics
+	usage := runUsage.Usage()
+	for model, u := range usage {
+		log.Info().
+			Str("Model", model).
+			Int("Requests", u.Requests).
+			Int("Input Tokens", u.InputTokens).
+			Int("Output Tokens", u.OutputTokens).
+			Float64("Cost", prices.Cost(translate.ModelUsage{model: u})).
+			Msg("usage")
+	}
+	total := usage.Total()
 	log.Info().
 		Int64("Successful Translations", successfulTranslations.Load()).
 		Int64("Failed Translations", failedTranslations.Load()).
+		Int64("Rejected Translations", rejectedTranslations.Load()).
+		Int64("Cached Chunks", cachedChunks.Load()).
+		Int("Input Tokens", total.InputTokens).
+		Int("Output Tokens", total.OutputTokens).
+		Float64("Cost", prices.Cost(usage)).
 		Int64("Last Read Index", lastReadIndex.Load()).
 		Msg("finished")
 
@@ -217,10 +381,9 @@ L:
 	log.Debug().Msg("reader stopped")
 }
 
-func translationWorker(id int, inLang string, outLang string, jobQueue <-chan Job, completionQueue chan<- *jsonl.Value, errorQueue chan<- *jsonl.Value, wg *sync.WaitGroup) {
+func translationWorker(ctx context.Context, id int, inLang string, outLangs []string, jobQueue <-chan Job, completionQueue chan<- *jsonl.Value, errorQueue chan<- *jsonl.Value, wg *sync.WaitGroup) {
 	defer wg.Done()
 	log.Debug().Int("ID", id).Msg("translation worker started")
-	_ = inLang
 L:
 	for job := range jobQueue {
 		v := job.Value
@@ -233,10 +396,13 @@ L:
 			}
 		}
 
+		// Tokens used for the row, summed over its retries.
+		usage := make(translate.ModelUsage)
 		credits := 3
 	RL:
 		for {
 			if credits <= 0 {
+				setUsage(v, usage)
 				errorQueue <- v
 				log.Error().Int("workerID", id).Int("Index", index).Msg("repeated translation fail, skipping")
 				break
@@ -245,20 +411,172 @@ L:
 
 			normalize.NormalizeShareGPT(v)
 			messages := v.GetArray("messages")
+			tools := rowTools(v)
 
 			for i := range messages {
 				original := string(messages[i].GetStringBytes("content"))
-				if string(messages[i].GetStringBytes("translated_content")) != "" {
+				var pending []string
+				for _, lang := range outLangs {
+					if string(messages[i].GetStringBytes(targetField("translated_content", lang, outLangs))) == "" {
+						pending = append(pending, lang)
+					}
+				}
+				if len(pending) == 0 {
 					continue
 				}
-				translated := ""
 
 				if !utf8.ValidString(original) {
 					continue
 				}
 				original = normalize.Normalize(original)
+				role := string(messages[i].GetStringBytes("role"))
+
+				// Messages with tool blocks are translated as a batch of their natural-language texts.
+				text := original
+				var doc *toolcall.Document
+				if toolCalls {
+					if doc = toolDocument(original, role, tools); doc != nil {
+						text = toolcall.Batch(doc.Texts())
+					}
+				}
+
+				detected := langid.Detect(original)
+				if doc != nil {
+					detected = langid.Detect(strings.Join(doc.Texts(), "\n\n"))
+				}
+				if detected.Language != "" {
+					messages[i].Set("source_language", jsonString(detected.Language))
+				}
+				if detected.Mixed {
+					messages[i].Set("language_mixed", fastjson.MustParse("true"))
+					log.Warn().Int("workerID", id).Int("Index", index).Int("message", i).Str("language", detected.Language).Str("secondary", detected.Secondary).Msg("mixed-language message")
+				}
+
+				var targets []string
+				for _, lang := range pending {
+					if (skipCode && detected.NoText) || (doc != nil && len(doc.Texts()) == 0) || (skipTargetLanguage && detected.Reliable() && detected.Language == langid.Code(lang)) {
+						data, err := json.Marshal(original)
+						if err != nil {
+							log.Error().Int("workerID", id).Int("Index", index).Err(err).Msg("marshal failed")
+							continue L
+						}
+						messages[i].Set(targetField("translated_content", lang, outLangs), fastjson.MustParseBytes(data))
+						messages[i].Set(targetField("translation_skipped", lang, outLangs), fastjson.MustParse("true"))
+						continue
+					}
+					targets = append(targets, lang)
+				}
+
+				var history []translate.Turn
+				if conversation != nil {
+					history = conversationHistory(messages[:i], outLangs)
+				}
+
+				// Every target shares the chunks of the message; the languages that succeeded are kept on retry.
+				results, err := translator.TranslateTargets(ctx, &translate.Request{
+					Text:           text,
+					SourceLanguage: inLang,
+					Register:       roleRegisters[role],
+					Role:           role,
+					History:        history,
+				}, targets)
+				usage.Merge(translate.UsageOf(err))
+				for _, lang := range targets {
+					result, ok := results[lang]
+					if !ok {
+						continue
+					}
+					translated := result.Text
+					cachedChunks.Add(int64(result.Cached))
+					usage.Merge(result.Usage)
+
+					if !utf8.ValidString(translated) {
+						log.Error().
+							Int("workerID", id).
+							Int("Index", index).
+							Str("lang", lang).
+							Err(fmt.Errorf("deeplingua: invalid utf8 string")).
+							Int("tokens", credits).
+							Msg("translate failed")
+						continue
+					}
+					translated = normalize.Normalize(translated)
+					if doc != nil {
+						rendered, renderErr := renderTools(doc, translated)
+						if renderErr != nil {
+							log.Error().Int("workerID", id).Int("Index", index).Int("message", i).Str("lang", lang).Err(renderErr).Msg("translated tool message is invalid")
+							if err == nil {
+								err = renderErr
+							}
+							continue
+						}
+						translated = rendered
+					}
+
+					data, err := json.Marshal(translated)
+					if err != nil {
+						log.Error().Int("workerID", id).Int("Index", index).Err(err).Msg("marshal failed")
+						continue L
+					}
+					messages[i].Set(targetField("translated_content", lang, outLangs), fastjson.MustParseBytes(data))
+					if result.Skipped {
+						messages[i].Set(targetField("translation_skipped", lang, outLangs), fastjson.MustParse("true"))
+					}
+					if result.Register != "" {
+						messages[i].Set(targetField("translation_register", lang, outLangs), jsonString(result.Register))
+					}
+					if len(result.Prompts) > 0 {
+						messages[i].Set(targetField("prompt_id", lang, outLangs), jsonString(strings.Join(result.Prompts, ",")))
+					}
+					if len(result.Refinements) > 0 {
+						data, err := json.Marshal(result.Refinements)
+						if err != nil {
+							log.Error().Int("workerID", id).Int("Index", index).Err(err).Msg("marshal failed")
+							continue L
+						}
+						messages[i].Set(targetField("translation_score", lang, outLangs), fastjson.MustParse(strconv.FormatFloat(result.Score, 'f', -1, 64)))
+						messages[i].Set(targetField("translation_refinements", lang, outLangs), fastjson.MustParseBytes(data))
+					}
+					if len(result.Selections) > 0 {
+						data, err := json.Marshal(result.Selections)
+						if err != nil {
+							log.Error().Int("workerID", id).Int("Index", index).Err(err).Msg("marshal failed")
+							continue L
+						}
+						messages[i].Set(targetField("translation_candidates", lang, outLangs), fastjson.MustParseBytes(data))
+					}
+					if len(result.Usage) > 0 {
+						data, err := json.Marshal(result.Usage)
+						if err != nil {
+							log.Error().Int("workerID", id).Int("Index", index).Err(err).Msg("marshal failed")
+							continue L
+						}
+						messages[i].Set(targetField("translation_usage", lang, outLangs), fastjson.MustParseBytes(data))
+					}
+					if alignment != "" && doc == nil {
+						segments := result.Segments
+						if alignment == "paragraph" {
+							segments = result.Paragraphs()
+						}
+						data, err := json.Marshal(normalizeSegments(segments))
+						if err != nil {
+							log.Error().Int("workerID", id).Int("Index", index).Err(err).Msg("marshal failed")
+							continue L
+						}
+						messages[i].Set(targetField("translation_segments", lang, outLangs), fastjson.MustParseBytes(data))
+					}
+					if len(result.Violations) > 0 {
+						data, err := json.Marshal(result.Violations)
+						if err != nil {
+							log.Error().Int("workerID", id).Int("Index", index).Err(err).Msg("marshal failed")
+							continue L
+						}
+						messages[i].Set(targetField("translation_violations", lang, outLangs), fastjson.MustParseBytes(data))
+						log.Warn().Int("workerID", id).Int("Index", index).Int("message", i).Str("lang", lang).Int("violations", len(result.Violations)).Msg("translation has violations")
+					}
+				}
+				v.Value.Get("messages").SetArrayItem(i, messages[i])
 
-				translated, err := translate.TranslateCustomPrompt(context.Background(), translationModel, original, outLang, customPrompt)
 				if err != nil {
 					log.Error().
 						Int("workerID", id).
@@ -266,31 +584,52 @@ L:
 						Err(err).
 						Int("tokens", credits).
 						Msg("translate failed")
-					time.Sleep(time.Duration(float64(10) * rand.Float64() * float64(time.Second)))
+
+					// Refusals do not go away on retry and cancellation means we are shutting down,
+					// so give up on the row right away.
+					var chunkErr *translate.ChunkError
+					if errors.As(err, &chunkErr) && (chunkErr.Kind == translate.ErrorRefused || chunkErr.Kind == translate.ErrorCanceled) {
+						setUsage(v, usage)
+						errorQueue <- v
+						log.Error().Int("workerID", id).Int("Index", index).Str("provider", chunkErr.Provider).Stringer("kind", chunkErr.Kind).Msg("translation aborted, skipping")
+						continue L
+					}
+					sleep(ctx, time.Duration(float64(10)*rand.Float64()*float64(time.Second)))
 					continue RL
 				}
+				if doEvaluation {
+					// TODO: evaluate - this part would be moved to evaluation worker if you have one
+				}
+			}
 
-				if !utf8.ValidString(translated) {
-					log.Error().
-						Int("workerID", id).
-						Int("Index", index).
-						Err(fmt.Errorf("deeplingua: invalid utf8 string")).
-						Int("tokens", credits).
-						Msg("translate failed")
-					time.Sleep(time.Duration(float64(10) * rand.Float64() * float64(time.Second)))
-					continue
+			if len(reasoningFields) > 0 {
+				err := translateReasoning(ctx, inLang, outLangs, messages, usage)
+				for i := range messages {
+					v.Value.Get("messages").SetArrayItem(i, messages[i])
+				}
+				if err != nil {
+					log.Error().Int("workerID", id).Int("Index", index).Err(err).Int("tokens", credits).Msg("reasoning translation failed")
+					sleep(ctx, time.Duration(float64(10)*rand.Float64()*float64(time.Second)))
+					continue RL
 				}
-				translated = normalize.Normalize(translated)
+			}
 
-				data, err := json.Marshal(translated)
+			if backTranslator != nil {
+				rejected, err := backTranslate(ctx, inLang, outLangs, messages, usage)
+				for i := range messages {
+					v.Value.Get("messages").SetArrayItem(i, messages[i])
+				}
 				if err != nil {
-					log.Error().Int("workerID", id).Int("Index", index).Err(err).Msg("marshal failed")
-					continue L
+					log.Error().Int("workerID", id).Int("Index", index).Err(err).Int("tokens", credits).Msg("back-translation failed")
+					sleep(ctx, time.Duration(float64(10)*rand.Float64()*float64(time.Second)))
+					continue RL
 				}
-				messages[i].Set("translated_content", fastjson.MustParseBytes(data))
-				v.Value.Get("messages").SetArrayItem(i, messages[i])
-				if doEvaluation {
-					// TODO: evaluate - this part would be moved to evaluation worker if you have one
+				if rejected {
+					rejectedTranslations.Add(1)
+					setUsage(v, usage)
+					errorQueue <- v
+					log.Error().Int("workerID", id).Int("Index", index).Msg("back-translation below threshold, skipping")
+					continue L
 				}
 			}
 
@@ -302,6 +641,7 @@ L:
 			}
 
 			log.Info().Int("workerID", id).Int("Index", index).Msg("translated successfully")
+			setUsage(v, usage)
 			completionQueue <- v
 			continue L
 		}
@@ -310,8 +650,40 @@ L:
 	log.Debug().Int("ID", id).Msg("translation worker stopped")
 }
 
+// normalizeSegments normalizes the texts of segs like the stored content and recomputes their offsets,
+// which normalization shifts.
+func normalizeSegments(segs []translate.Segment) []translate.Segment {
+	out := make([]translate.Segment, len(segs))
+	var src, dst int
+	for i, seg := range segs {
+		seg.Source, seg.Translation = normalize.Normalize(seg.Source), normalize.Normalize(seg.Translation)
+		seg.SourceStart, seg.SourceEnd = src, src+len(seg.Source)
+		seg.TranslationStart, seg.TranslationEnd = dst, dst+len(seg.Translation)
+		src, dst = seg.SourceEnd, seg.TranslationEnd
+		out[i] = seg
+	}
+	return out
+}
+
+// jsonString returns s as a JSON string value.
+func jsonString(s string) *fastjson.Value {
+	data, _ := json.Marshal(s) // marshalling a string cannot fail
+	return fastjson.MustParseBytes(data)
+}
+
+// sleep waits for d or until ctx is done.
+func sleep(ctx context.Context, d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
 // writerWorker handles writing both successful and failed jobs to their respective files.
-func writerWorker(completionQueue <-chan *jsonl.Value, errorQueue <-chan *jsonl.Value, w *jsonl.Writer, wfail *jsonl.Writer, wg *sync.WaitGroup) {
+func writerWorker(completionQueue <-chan *jsonl.Value, errorQueue <-chan *jsonl.Value, w valueWriter, wfail *jsonl.Writer, wg *sync.WaitGroup) {
 	defer wg.Done()
 	log.Debug().Msg("writer worker started")
 
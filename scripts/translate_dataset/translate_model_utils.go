@@ -21,8 +21,13 @@ func NewLoadBalancingModel(models ...llm.Model) *LoadBalancingModel {
 }
 
 func (g *LoadBalancingModel) GenerateStream(ctx context.Context, chat *llm.ChatContext, input *llm.Content) *llm.StreamContent {
+	return g.Pick().GenerateStream(ctx, chat, input)
+}
+
+// Pick returns the model that handles the next request.
+func (g *LoadBalancingModel) Pick() llm.Model {
 	idx := g.idx.Add(1) % int64(len(g.models))
-	return g.models[idx].GenerateStream(ctx, chat, input)
+	return g.models[idx]
 }
 
 func (g *LoadBalancingModel) Close() error {
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/rs/zerolog/log"
+	"github.com/valyala/fastjson"
+	"gosuda.org/deeplingua/internal/translate"
+	"gosuda.org/deeplingua/jsonl"
+)
+
+// rowUsage is the token usage of a row and its cost according to prices.
+type rowUsage struct {
+	translate.Usage
+	Cost float64 `json:"cost"`
+}
+
+// setUsage stores the total of usage and its cost in the "translation_usage_total" field of v,
+// leaving any "usage" field of the dataset alone. Unlike the per-model "translation_usage"
+// of every message, it sums all models and every stage of the row.
+func setUsage(v *jsonl.Value, usage translate.ModelUsage) {
+	data, err := json.Marshal(rowUsage{Usage: usage.Total(), Cost: prices.Cost(usage)})
+	if err != nil {
+		log.Error().Err(err).Msg("marshal failed")
+		return
+	}
+	v.Set("translation_usage_total", fastjson.MustParseBytes(data))
+}
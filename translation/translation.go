@@ -2,17 +2,181 @@ package translation
 
 import (
 	"context"
+	"iter"
 
 	"github.com/lemon-mint/coord/llm"
+	"gosuda.org/deeplingua/internal/judge"
+	"gosuda.org/deeplingua/internal/mask"
 	"gosuda.org/deeplingua/internal/translate"
 )
 
-var ErrFailedToTranslate = translate.ErrFailedToTranslate
+var (
+	ErrFailedToTranslate = translate.ErrFailedToTranslate
+	ErrTokenMismatch     = mask.ErrTokenMismatch
+)
+
+type (
+	Translator  = translate.Translator
+	Option      = translate.Option
+	Chunker     = translate.Chunker
+	RetryPolicy = translate.RetryPolicy
+	Attempt     = translate.Attempt
+
+	ExponentialBackoff = translate.ExponentialBackoff
+	RetryAfterError    = translate.RetryAfterError
+	Result             = translate.Result
+	Segment            = translate.Segment
+	TranslatedChunk    = translate.TranslatedChunk
+	Cache              = translate.Cache
+	Evaluator          = translate.Evaluator
+	Refinement         = translate.Refinement
+	Judge              = judge.Evaluator
+	Candidate          = translate.Candidate
+	Selection          = translate.Selection
+	Scorer             = translate.Scorer
+	ViolationScorer    = translate.ViolationScorer
+	JudgeScorer        = translate.JudgeScorer
+	JudgeEvaluation    = judge.Evaluation
+	PromptData         = translate.PromptData
+	ContextPair        = translate.ContextPair
+	Request            = translate.Request
+	Turn               = translate.Turn
+	ModelPicker        = translate.ModelPicker
+	Usage              = translate.Usage
+	ModelUsage         = translate.ModelUsage
+	UsageRecorder      = translate.UsageRecorder
+	UsageCounter       = translate.UsageCounter
+	UsageError         = translate.UsageError
+	Price              = translate.Price
+	Prices             = translate.Prices
+
+	Glossary          = translate.Glossary
+	Profile           = translate.Profile
+	Profiles          = translate.Profiles
+	Validator         = translate.Validator
+	MarkdownValidator = translate.MarkdownValidator
+	EntityValidator   = translate.EntityValidator
+	EntityKind        = translate.EntityKind
+	Violation         = translate.Violation
+	ValidationPolicy  = translate.ValidationPolicy
+	ReasoningPolicy   = translate.ReasoningPolicy
+	MaskKind          = mask.Kind
+
+	ChunkError = translate.ChunkError
+	ErrorKind  = translate.ErrorKind
+)
+
+const (
+	ValidationRetry = translate.ValidationRetry
+	ValidationFlag  = translate.ValidationFlag
+)
+
+const (
+	ReasoningTranslate = translate.ReasoningTranslate
+	ReasoningKeep      = translate.ReasoningKeep
+	ReasoningSeparate  = translate.ReasoningSeparate
+)
+
+const (
+	ErrorUnknown       = translate.ErrorUnknown
+	ErrorMarkerMissing = translate.ErrorMarkerMissing
+	ErrorTruncated     = translate.ErrorTruncated
+	ErrorRateLimited   = translate.ErrorRateLimited
+	ErrorRefused       = translate.ErrorRefused
+	ErrorCanceled      = translate.ErrorCanceled
+	ErrorTokenMismatch = translate.ErrorTokenMismatch
+	ErrorValidation    = translate.ErrorValidation
+)
+
+const (
+	MaskInlineCode  = mask.InlineCode
+	MaskURL         = mask.URL
+	MaskEmail       = mask.Email
+	MaskMath        = mask.Math
+	MaskHTML        = mask.HTML
+	MaskPlaceholder = mask.Placeholder
+	MaskAll         = mask.All
+)
 
+const (
+	EntityURL        = translate.EntityURL
+	EntityEmail      = translate.EntityEmail
+	EntityVersion    = translate.EntityVersion
+	EntityDate       = translate.EntityDate
+	EntityCurrency   = translate.EntityCurrency
+	EntityNumber     = translate.EntityNumber
+	EntityProperNoun = translate.EntityProperNoun
+	EntityAll        = translate.EntityAll
+	EntityDefault    = translate.EntityDefault
+)
+
+const DefaultSplitDepth = translate.DefaultSplitDepth
+
+var (
+	DefaultPrompt          = translate.DefaultPrompt
+	DefaultReasoningPrompt = translate.DefaultReasoningPrompt
+	DefaultProfiles        = translate.DefaultProfiles
+	DefaultChunker         = translate.DefaultChunker
+	DefaultRetryPolicy     = translate.DefaultRetryPolicy
+)
+
+var (
+	WithPrompt           = translate.WithPrompt
+	WithCustomPrompt     = translate.WithCustomPrompt
+	WithChunker          = translate.WithChunker
+	WithChunkTokens      = translate.WithChunkTokens
+	WithReasoning        = translate.WithReasoning
+	WithReasoningPrompt  = translate.WithReasoningPrompt
+	WithRetryPolicy      = translate.WithRetryPolicy
+	WithSourceLanguage   = translate.WithSourceLanguage
+	WithTargetLanguage   = translate.WithTargetLanguage
+	WithRegister         = translate.WithRegister
+	WithRegisterProfiles = translate.WithRegisterProfiles
+	WithConcurrency      = translate.WithConcurrency
+	WithContextWindow    = translate.WithContextWindow
+	WithGlossary         = translate.WithGlossary
+	WithValidator        = translate.WithValidator
+	WithValidationPolicy = translate.WithValidationPolicy
+	WithLogger           = translate.WithLogger
+
+	WithDomain             = translate.WithDomain
+	WithSkipTargetLanguage = translate.WithSkipTargetLanguage
+	WithMasking            = translate.WithMasking
+	WithSplitDepth         = translate.WithSplitDepth
+	WithCache              = translate.WithCache
+	WithSharedCache        = translate.WithSharedCache
+	WithRefinement         = translate.WithRefinement
+	WithCandidates         = translate.WithCandidates
+	WithUsageRecorder      = translate.WithUsageRecorder
+)
+
+var (
+	LoadGlossary = translate.LoadGlossary
+	LoadProfiles = translate.LoadProfiles
+	UsageOf      = translate.UsageOf
+)
+
+// NewTranslator creates a Translator using l as the translation model.
+func NewTranslator(l llm.Model, opts ...Option) *Translator {
+	return translate.New(l, opts...)
+}
+
+// TranslateText translates input into targetLanguage.
+//
+// Deprecated: use NewTranslator with WithTargetLanguage.
 func TranslateText(ctx context.Context, l llm.Model, input, targetLanguage string) (string, error) {
-	return translate.Translate(ctx, l, input, targetLanguage)
+	return translate.New(l, translate.WithTargetLanguage(targetLanguage)).Translate(ctx, input)
+}
+
+// TranslateTextStream translates input into targetLanguage and yields every chunk as soon as it
+// and all chunks before it are translated. See Translator.TranslateStream.
+func TranslateTextStream(ctx context.Context, l llm.Model, input, targetLanguage string) iter.Seq2[TranslatedChunk, error] {
+	return translate.New(l, translate.WithTargetLanguage(targetLanguage)).TranslateStream(ctx, input)
 }
 
+// TranslateTextCustomPrompt translates input into targetLanguage with additional instructions.
+//
+// Deprecated: use NewTranslator with WithTargetLanguage and WithCustomPrompt.
 func TranslateTextCustomPrompt(ctx context.Context, l llm.Model, input, targetLanguage string, customPrompt string) (string, error) {
-	return translate.TranslateCustomPrompt(ctx, l, input, targetLanguage, customPrompt)
+	return translate.New(l, translate.WithTargetLanguage(targetLanguage), translate.WithCustomPrompt(customPrompt)).Translate(ctx, input)
 }